@@ -2,10 +2,17 @@ package botify
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -30,32 +37,167 @@ type Bot struct {
 	// The size of the worker pool.
 	// Defaults to the number of CPU cores.
 	WorkerPool int
+	// Stores conversation states, see [Bot.HandleState].
+	// Defaults to [MemoryStateStorage]
+	States StateStorage
+	// Time after which conversation states expire.
+	// Zero means they never expire
+	StateTimeout time.Duration
+	// If set, the updates with the same key are processed sequentially, in the order they were received,
+	// while the updates with different keys are still processed in parallel.
+	// See [ShardByChat] and [ShardByUser].
+	// If nil, every update is processed by the first free worker,
+	// so the updates from the same chat may be processed concurrently and out of order.
+	// Every worker keeps up to ChanSize updates, but at least one, waiting to be processed.
+	// Once they're full, no more updates are received until the worker catches up.
+	// Can't be used with [Webhook.ReplyInResponse], which handles the updates bypassing the workers.
+	ShardBy ShardFunc
+	// If true, [Bot.Shutdown] sends /close request,
+	// which is needed only to move the bot from one local Bot API server to another.
+	// The request is rate-limited for the first 10 minutes after the bot is launched.
+	CloseOnShutdown bool
+	// If true, [Bot.Shutdown] sends /logOut request,
+	// which is needed only to move the bot from the cloud Bot API server to a local one.
+	LogOutOnShutdown bool
+	// The time given to the handlers to finish their work
+	// when the bot is shut down by [Bot.ServeContext] or [Bot.ServeWithSignals].
+	// Zero means no limit
+	ShutdownTimeout time.Duration
+	// The time given to handle every update, global middleware included.
+	// The context of the handler is cancelled once it's exceeded, see [Timeout] for details.
+	// Zero means no limit
+	HandlerTimeout time.Duration
+	// Called when the handler returns after its timeout,
+	// e.g. to notify the user that something went wrong or to collect metrics.
+	// The context is no longer limited by the timeout, so it can still be used to send requests.
+	// See [Bot.HandlerTimeout] and [Timeout]
+	OnHandlerTimeout func(ctx *Context)
+	// If set, the bot handles the groups upgraded to supergroups:
+	// the requests to the old chats are sent to the new ones, see [ChatMigration],
+	// and OnChatMigrated is called once for every migrated chat,
+	// either after such request, or after the service message with MigrateToChatId is received.
+	// Note that the bot's Sender is wrapped once the bot is launched
+	OnChatMigrated func(oldID, newID int64)
 
 	// only through methods, for stability
-	updateHandlers  map[string]HandlerFunc
-	commandHandlers *commandRegistry
+	updateHandlers   map[string]*Router
+	commandHandlers  *commandRegistry
+	callbackHandlers *callbackRegistry
+	stateHandlers    map[string]HandlerFunc
+	middleware       []Middleware
+	migrations       *chatMigrations
 
 	chUpdate chan Update
 	ctx      context.Context
 	cancel   context.CancelFunc
+	// holds *lifecycle, see [Bot.Shutdown]
+	running atomic.Value
 
 	initErr error
 }
 
+// Use adds middleware to the global middleware chain.
+// Global middleware is applied to every dispatched update, commands included,
+// in the order it was added: the first one is the outermost.
+// It always wraps around the middleware assigned to a specific handler.
+func (b *Bot) Use(middleware ...Middleware) *Bot {
+	b.middleware = append(b.middleware, middleware...)
+	return b
+}
+
 // Handle assigns handler to work with incoming updates of type t.
+// If there are any handlers assigned with [Bot.HandleFiltered] to the same update type,
+// this handler is used only if none of them matches the update.
+// If any middleware is given, it is applied only to this handler, see [WrapHandler] for ordering.
 // See [API specs for Update] for a complete list of available update types.
 //
 // [API specs for Update]: https://core.telegram.org/bots/api#update
-func (b *Bot) Handle(t string, handler HandlerFunc) *Bot {
-	if b.updateHandlers == nil {
-		b.updateHandlers = make(map[string]HandlerFunc)
+func (b *Bot) Handle(t string, handler HandlerFunc, middleware ...Middleware) *Bot {
+	if r := b.router(t); r != nil {
+		r.Fallback(WrapHandler(handler, middleware...))
 	}
-	if _, ok := allUpdTypes[t]; ok {
-		b.updateHandlers[t] = handler
+	return b
+}
+
+// With returns the [HandlerGroup] which assigns the handlers with the middleware applied only to them,
+// e.g. bot.With(auth).HandleCommand("/admin", "Admin panel", handleAdmin).
+// It's needed for the methods which already take scopes or filters, so they can't take the middleware themselves.
+// See [WrapHandler] for ordering.
+func (b *Bot) With(middleware ...Middleware) *HandlerGroup {
+	return &HandlerGroup{bot: b, middleware: slices.Clone(middleware)}
+}
+
+// HandlerGroup assigns the handlers to the bot with the same middleware, see [Bot.With].
+// Its methods work just like the methods of [Bot] with the same names.
+type HandlerGroup struct {
+	bot        *Bot
+	middleware []Middleware
+}
+
+// Handle works like [Bot.Handle].
+func (g *HandlerGroup) Handle(t string, handler HandlerFunc) *HandlerGroup {
+	g.bot.Handle(t, handler, g.middleware...)
+	return g
+}
+
+// HandleFiltered works like [Bot.HandleFiltered].
+func (g *HandlerGroup) HandleFiltered(t string, handler HandlerFunc, filters ...Filter) *HandlerGroup {
+	g.bot.HandleFiltered(t, WrapHandler(handler, g.middleware...), filters...)
+	return g
+}
+
+// HandleCommand works like [Bot.HandleCommand].
+func (g *HandlerGroup) HandleCommand(cmd, desc string, handler HandlerFunc, scopes ...BotCommandScope) *HandlerGroup {
+	g.bot.HandleCommand(cmd, desc, WrapHandler(handler, g.middleware...), scopes...)
+	return g
+}
+
+// HandleCommandWithLocales works like [Bot.HandleCommandWithLocales].
+func (g *HandlerGroup) HandleCommandWithLocales(cmd string, locales LocaleMap, handler HandlerFunc, scopes ...BotCommandScope) *HandlerGroup {
+	g.bot.HandleCommandWithLocales(cmd, locales, WrapHandler(handler, g.middleware...), scopes...)
+	return g
+}
+
+// HandleCallback works like [Bot.HandleCallback].
+func (g *HandlerGroup) HandleCallback(pattern string, handler HandlerFunc) *HandlerGroup {
+	g.bot.HandleCallback(pattern, handler, g.middleware...)
+	return g
+}
+
+// HandleState works like [Bot.HandleState].
+func (g *HandlerGroup) HandleState(state string, handler HandlerFunc) *HandlerGroup {
+	g.bot.HandleState(state, handler, g.middleware...)
+	return g
+}
+
+// HandleFiltered assigns handler to work with incoming updates of type t,
+// but only with those which match every filter.
+// Filtered handlers are tried in the order they were assigned,
+// and the first matching one is used.
+// If none of them matches, the handler assigned with [Bot.Handle] is used as a fallback.
+// To apply middleware only to this handler, use [Bot.With].
+func (b *Bot) HandleFiltered(t string, handler HandlerFunc, filters ...Filter) *Bot {
+	if r := b.router(t); r != nil {
+		r.Handle(handler, filters...)
 	}
 	return b
 }
 
+func (b *Bot) router(t string) *Router {
+	if _, ok := allUpdTypes[t]; !ok {
+		return nil
+	}
+	if b.updateHandlers == nil {
+		b.updateHandlers = make(map[string]*Router)
+	}
+	r, ok := b.updateHandlers[t]
+	if !ok {
+		r = new(Router)
+		b.updateHandlers[t] = r
+	}
+	return r
+}
+
 // LocaleMap is used to provide a localization for the command.
 // The key must be a two-letter ISO 639-1 language code.
 // The value must be 1-256 characters long command description.
@@ -63,7 +205,8 @@ type LocaleMap map[string]string
 
 // HandleCommandWithLocales assigns the handler to work with the cmd command.
 // Once the bot is launched, it will send a request to /setMyCommands,
-// adding the cmd command to the bot's list of commands in each given scopes and with each given locales translation
+// adding the cmd command to the bot's list of commands in each given scopes and with each given locales translation.
+// To apply middleware only to this command, use [Bot.With].
 //
 // NOTE: if, for example, a command is assigned to private chat and default scope,
 // and you open the list of commands in private chat, you will see only private commands.
@@ -126,6 +269,7 @@ func (b *Bot) HandleCommandWithLocales(cmd string, locales LocaleMap, handler Ha
 }
 
 // HandleCommand assigns the handler to work with the cmd command.
+// To apply middleware only to this command, use [Bot.With].
 // Once the bot is launched, it will send a request to /setMyCommands,
 // adding the cmd command to the bot's list of commands in each given scopes with desc as default command description
 //
@@ -139,6 +283,49 @@ func (b *Bot) HandleCommand(cmd, desc string, handler HandlerFunc, scopes ...Bot
 	return b.HandleCommandWithLocales(cmd, LocaleMap{"en": desc}, handler, scopes...)
 }
 
+// HandleCallback assigns the handler to work with callback queries
+// whose data matches the pattern.
+// The pattern may contain named placeholders in curly braces, e.g. "item:{id}:delete",
+// each of them matches one or more characters except ':'.
+// Extracted values are available through [Context.Param] and [Context.Params].
+// Patterns are tried in the order they were assigned.
+// If none of them matches, the handler assigned with [Bot.Handle] to [UpdateTypeCallbackQuery] is used.
+//
+// If the handler doesn't answer the callback query with [AnswerCallbackQuery],
+// the query is answered automatically once the handler returns,
+// so the client stops showing the progress bar.
+// If any middleware is given, it is applied only to this handler, see [WrapHandler] for ordering.
+func (b *Bot) HandleCallback(pattern string, handler HandlerFunc, middleware ...Middleware) *Bot {
+	if b.callbackHandlers == nil {
+		b.callbackHandlers = new(callbackRegistry)
+	}
+	if err := b.callbackHandlers.AddHandler(pattern, WrapHandler(handler, middleware...)); err != nil {
+		b.initErr = err
+	}
+	return b
+}
+
+// HandleState assigns the handler to work with every update
+// from the conversations which are in the given state.
+// A conversation is the user in the chat (and in the forum topic, if there's any),
+// its state is changed from the handlers with [Context.SetState] and [Context.ClearState].
+//
+// Command handlers are always used before the state handlers, so commands like /cancel still work.
+// State handlers are used before any other handlers.
+// For more precise control, use [InState] filter with [Bot.HandleFiltered].
+// If any middleware is given, it is applied only to this handler, see [WrapHandler] for ordering.
+func (b *Bot) HandleState(state string, handler HandlerFunc, middleware ...Middleware) *Bot {
+	if state == "" {
+		b.initErr = fmt.Errorf("state must be non-empty")
+		return b
+	}
+	if b.stateHandlers == nil {
+		b.stateHandlers = make(map[string]HandlerFunc)
+	}
+	b.stateHandlers[state] = WrapHandler(handler, middleware...)
+	return b
+}
+
 // Serve is launching the bot.
 // It will panic if bot has empty API tolen.
 // It will return an error if:
@@ -146,60 +333,232 @@ func (b *Bot) HandleCommand(cmd, desc string, handler HandlerFunc, scopes ...Bot
 //  2. you're trying to run long-polling bot when webhook is set
 //     (you should send /deleteWebhook request first)
 //  3. something went wrong in [UpdateReceiver] and it can no longer receive updates
+//
+// Once [Bot.Shutdown] is called, Serve stops receiving updates and returns nil right away,
+// without waiting for the handlers, so the program should wait for Shutdown to return instead.
+// If the receiver stops by itself, Serve waits for the received updates to be handled before returning.
 func (b *Bot) Serve() error {
+	return b.ServeContext(context.Background())
+}
+
+// ServeContext works just like [Bot.Serve],
+// but the bot is gracefully shut down once ctx is done, see [Bot.Shutdown].
+// In that case ServeContext returns only after the shutdown is complete,
+// which takes no longer than [Bot.ShutdownTimeout], if it's set.
+//
+// If ctx is done before the bot is launched, ctx's error is returned.
+//
+// The context of every handler, see [Context.Context], is derived from ctx,
+// so it carries ctx's values and deadline,
+// but it's cancelled only after the received updates are handled, not right away.
+func (b *Bot) ServeContext(ctx context.Context) error {
 	if b.initErr != nil {
 		return fmt.Errorf("configuration error: %w", b.initErr)
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// creating context, channels, settting defaults, etc etc...
-	b.init()
+	b.init(ctx)
 
 	// checking if we can launch the bot
-	wh, err := b.getWebhookInfo()
+	wh, err := b.getWebhookInfo(ctx)
 	if err != nil {
 		// FIXME: there is a better way to handle this
 		b.Logger.Error(err, "failed to get webhook info")
 		return fmt.Errorf("getting webhook info: %w", err)
 	}
-	if _, ok := b.Receiver.(*LongPolling); ok && wh.URL != "" {
-		b.Logger.Error(err, "can't use long-polling when webhook is set")
-		return fmt.Errorf("can't use long-polling when webhook is set; use deleteWebhook before running long polling bot")
+	if lp, ok := b.Receiver.(*LongPolling); ok && wh.URL != "" && !lp.DeleteWebhook {
+		b.Logger.Error(err, "can't use long-polling when webhook is set", "url", wh.URL)
+		return fmt.Errorf("can't use long-polling when webhook is set; use deleteWebhook or LongPolling.DeleteWebhook before running long polling bot")
 	}
 
 	// adding the list of handled commands to the bot menu on the client side
-	if err = b.setupCommands(); err != nil {
+	if err = b.setupCommands(ctx); err != nil {
 		b.Logger.Error(err, "failed to set bot commands; continuing to serve")
 		// bot can function without commands in bot menu
 	}
 
-	defer b.Shutdown()
-	for range b.WorkerPool {
-		go b.work()
+	// the bot must be running before the shutdown is triggered,
+	// otherwise it would be lost if ctx is already done
+	lc := b.start()
+	shutdownDone := make(chan error, 1)
+	stop := context.AfterFunc(ctx, func() {
+		b.Logger.Info("context is done, shutting down")
+		shutdownDone <- b.shutdownWithTimeout()
+	})
+
+	err = b.receive(lc)
+	if !stop() {
+		// ctx is done, waiting for the shutdown to complete
+		if shutdownErr := <-shutdownDone; shutdownErr != nil {
+			return shutdownErr
+		}
+	}
+	return err
+}
+
+// ServeWithSignals works just like [Bot.ServeContext],
+// but the bot is also gracefully shut down when the program receives one of the signals.
+// If no signals are given, it listens for SIGINT and SIGTERM.
+func (b *Bot) ServeWithSignals(ctx context.Context, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+	defer stop()
+	return b.ServeContext(ctx)
+}
+
+// shutdownWithTimeout calls Shutdown limited by [Bot.ShutdownTimeout]
+func (b *Bot) shutdownWithTimeout() error {
+	ctx := context.Background()
+	if b.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.ShutdownTimeout)
+		defer cancel()
+	}
+	return b.Shutdown(ctx)
+}
+
+// lifecycle is the state of the running bot, created on every launch
+type lifecycle struct {
+	receiverCtx   context.Context
+	stopReceiving context.CancelFunc
+	receiverDone  chan struct{}
+
+	workers      sync.WaitGroup
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// start starts the workers, from now on the bot can be shut down
+func (b *Bot) start() *lifecycle {
+	lc := &lifecycle{receiverDone: make(chan struct{})}
+	lc.receiverCtx, lc.stopReceiving = context.WithCancel(b.ctx)
+
+	b.startWorkers(lc)
+	b.running.Store(lc)
+	return lc
+}
+
+// receive receives updates until the receiver stops
+func (b *Bot) receive(lc *lifecycle) error {
+	err := b.Receiver.ReceiveUpdates(lc.receiverCtx, b.chUpdate)
+	close(lc.receiverDone)
+
+	if lc.receiverCtx.Err() != nil {
+		// stopped by Shutdown, which takes care of the rest
+		return nil
+	}
+
+	if shutdownErr := b.Shutdown(context.Background()); shutdownErr != nil {
+		b.Logger.Error(shutdownErr, "shutting down after the receiver has stopped")
 	}
-	return b.Receiver.ReceiveUpdates(b.ctx, b.chUpdate)
+	return err
 }
 
-// TODO: make it more graceful
+// Shutdown gracefully stops the bot launched with [Bot.Serve]:
+//  1. stops receiving new updates;
+//  2. waits until every update received so far is handled;
+//  3. confirms the handled updates, if the receiver supports it, see [LongPolling.CommitOffset];
+//  4. sends /close and /logOut requests, but only if [Bot.CloseOnShutdown] or [Bot.LogOutOnShutdown] is set.
+//
+// If ctx expires before every update is handled,
+// the context of the running handlers is cancelled, the rest of the updates are dropped,
+// nothing is confirmed and the context's error is returned.
+// Calling Shutdown more than once returns the result of the first call.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	lc, _ := b.running.Load().(*lifecycle)
+	if lc == nil {
+		return fmt.Errorf("bot is not running")
+	}
+
+	lc.shutdownOnce.Do(func() {
+		lc.shutdownErr = b.shutdown(ctx, lc)
+	})
+	return lc.shutdownErr
+}
+
+func (b *Bot) shutdown(ctx context.Context, lc *lifecycle) error {
+	// the handlers are cancelled in any case, but only after they're done or it's too late
+	defer b.cancel()
+
+	b.Logger.Info("shutting down: stopping the receiver")
+	lc.stopReceiving()
+	select {
+	case <-lc.receiverDone:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the receiver to stop: %w", ctx.Err())
+	}
 
-// currently no use actually
-func (b *Bot) Shutdown() error {
-	b.cancel()
+	// nobody writes into the channel anymore, so the workers can drain it and exit
 	close(b.chUpdate)
 
-	resp, err := b.Sender.Send(Close)
-	if err != nil {
-		return err
+	b.Logger.Info("shutting down: waiting for the handlers")
+	handled := make(chan struct{})
+	go func() {
+		lc.workers.Wait()
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the handlers: %w", ctx.Err())
+	}
+
+	var errs []error
+	if c, ok := b.Receiver.(offsetCommitter); ok {
+		if err := c.CommitOffset(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("committing offset: %w", err))
+		}
+	}
+	if b.CloseOnShutdown {
+		if err := b.sendNoParams(ctx, Close); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	if !resp.IsSuccessful() {
-		// i mean do i care if it was closed too early?
-		if resp.ErrorCode != 429 {
-			return resp.GetError()
+	if b.LogOutOnShutdown {
+		if err := b.sendNoParams(ctx, LogOut); err != nil {
+			errs = append(errs, err)
 		}
 	}
+
+	b.Logger.Info("shutting down: done")
+	return errors.Join(errs...)
+}
+
+// offsetCommitter is implemented by the receivers which have to confirm the handled updates,
+// see [LongPolling.CommitOffset]
+type offsetCommitter interface {
+	CommitOffset(ctx context.Context) error
+}
+
+func (b *Bot) sendNoParams(ctx context.Context, m methodWithNoParams[bool]) error {
+	resp, err := b.Sender.SendWithContext(ctx, m)
+	if err != nil {
+		return fmt.Errorf("sending %s request: %w", m, err)
+	}
+	if err = resp.GetError(); err != nil {
+		return fmt.Errorf("%s: %w", m, err)
+	}
 	return nil
 }
 
-func (b *Bot) init() {
+func (b *Bot) deleteWebhook(ctx context.Context, dropPendingUpdates bool) error {
+	resp, err := b.Sender.SendWithContext(ctx, &DeleteWebhook{DropPendingUpdates: dropPendingUpdates})
+	if err != nil {
+		return fmt.Errorf("sending deleteWebhook request: %w", err)
+	}
+	if err = resp.GetError(); err != nil {
+		return fmt.Errorf("deleting webhook: %w", err)
+	}
+	return nil
+}
+
+func (b *Bot) init(parent context.Context) {
 	if b.Token == "" {
 		panic("API token must not be empty")
 	}
@@ -216,6 +575,11 @@ func (b *Bot) init() {
 		}
 	}
 
+	if b.OnChatMigrated != nil && b.migrations == nil {
+		b.migrations = &chatMigrations{onMigrated: b.OnChatMigrated}
+		b.Sender = WrapSender(b.Sender, b.migrations.middleware)
+	}
+
 	if b.Receiver == nil {
 		b.Logger.Info("update receiver is nil, using default", "receiver", "LongPolling")
 		b.Receiver = &LongPolling{
@@ -237,18 +601,65 @@ func (b *Bot) init() {
 	}
 
 	if b.updateHandlers == nil {
-		b.updateHandlers = make(map[string]HandlerFunc)
+		b.updateHandlers = make(map[string]*Router)
 	}
 	if b.commandHandlers == nil {
 		b.commandHandlers = new(commandRegistry)
 	}
+	if b.callbackHandlers == nil {
+		b.callbackHandlers = new(callbackRegistry)
+	}
 
-	b.ctx, b.cancel = context.WithCancel(context.Background())
+	if b.States == nil {
+		b.States = new(MemoryStateStorage)
+	}
+
+	// the handlers must be able to finish their work when the parent is cancelled,
+	// but they can't outlive its deadline
+	base := context.WithoutCancel(parent)
+	if deadline, ok := parent.Deadline(); ok {
+		b.ctx, b.cancel = context.WithDeadline(base, deadline)
+	} else {
+		b.ctx, b.cancel = context.WithCancel(base)
+	}
 	b.chUpdate = make(chan Update, b.ChanSize)
 }
 
-func (b *Bot) getWebhookInfo() (*WebhookInfo, error) {
-	r, err := b.Sender.Send(GetWebhookInfo)
+// id returns bot's user ID, which is the first part of the API token
+func (b *Bot) id() (int, bool) {
+	before, _, found := strings.Cut(b.Token, ":")
+	if !found {
+		return 0, false
+	}
+	id, err := strconv.Atoi(before)
+	return id, err == nil
+}
+
+// allowedUpdates returns the list of update types the bot has handlers for
+func (b *Bot) allowedUpdates() []string {
+	allowed := make([]string, 0, len(b.updateHandlers)+2)
+	for upd := range b.updateHandlers {
+		allowed = append(allowed, upd)
+	}
+	if len(b.commandHandlers.byCommand) > 0 && !slices.Contains(allowed, UpdateTypeMessage) {
+		allowed = append(allowed, UpdateTypeMessage)
+	}
+	if b.callbackHandlers.Len() > 0 && !slices.Contains(allowed, UpdateTypeCallbackQuery) {
+		allowed = append(allowed, UpdateTypeCallbackQuery)
+	}
+	// conversations are mostly about messages and buttons
+	if len(b.stateHandlers) > 0 {
+		for _, t := range []string{UpdateTypeMessage, UpdateTypeCallbackQuery} {
+			if !slices.Contains(allowed, t) {
+				allowed = append(allowed, t)
+			}
+		}
+	}
+	return allowed
+}
+
+func (b *Bot) getWebhookInfo(ctx context.Context) (*WebhookInfo, error) {
+	r, err := b.Sender.SendWithContext(ctx, GetWebhookInfo)
 	if err != nil {
 		return nil, fmt.Errorf("requesting for webhook info: %w", err)
 	}
@@ -273,21 +684,21 @@ var scopeMap = map[string]func(scopeKey) BotCommandScope{
 	},
 }
 
-func (b *Bot) setupCommands() error {
+func (b *Bot) setupCommands(ctx context.Context) error {
 	scopes := b.commandHandlers.GetScopes()
 	if len(scopes) == 0 {
 		return nil
 	}
 
 	for _, scope := range scopes {
-		if err := b.syncCommandsByScope(scope); err != nil {
+		if err := b.syncCommandsByScope(ctx, scope); err != nil {
 			return fmt.Errorf("syncing commands for scope %s: %w", scope.Scope, err)
 		}
 	}
 	return nil
 }
 
-func (b *Bot) syncCommandsByScope(key scopeKey) error {
+func (b *Bot) syncCommandsByScope(ctx context.Context, key scopeKey) error {
 	scopeFunc, exists := scopeMap[key.Scope]
 	if !exists {
 		return fmt.Errorf("unknown bot command scope: %s", key.Scope)
@@ -295,7 +706,7 @@ func (b *Bot) syncCommandsByScope(key scopeKey) error {
 
 	scope := scopeFunc(key)
 
-	currentCommands, err := b.getCurrentCommands(scope)
+	currentCommands, err := b.getCurrentCommands(ctx, scope)
 	if err != nil {
 		return fmt.Errorf("getting current commands: %w", err)
 	}
@@ -303,7 +714,7 @@ func (b *Bot) syncCommandsByScope(key scopeKey) error {
 	myCommands := b.commandHandlers.GetCommands(key)
 
 	if !isEqualCommands(myCommands, currentCommands) {
-		if err = b.setCommands(scope, myCommands); err != nil {
+		if err = b.setCommands(ctx, scope, myCommands); err != nil {
 			return fmt.Errorf("setting commands: %w", err)
 		}
 	}
@@ -311,10 +722,10 @@ func (b *Bot) syncCommandsByScope(key scopeKey) error {
 	return nil
 }
 
-func (b *Bot) getCurrentCommands(scope BotCommandScope) ([]BotCommand, error) {
+func (b *Bot) getCurrentCommands(ctx context.Context, scope BotCommandScope) ([]BotCommand, error) {
 	gmc := GetMyCommands{Scope: scope}
 
-	resp, err := b.Sender.Send(&gmc)
+	resp, err := b.Sender.SendWithContext(ctx, &gmc)
 	if err != nil {
 		return nil, fmt.Errorf("getting current commands: %w", err)
 	}
@@ -326,7 +737,7 @@ func (b *Bot) getCurrentCommands(scope BotCommandScope) ([]BotCommand, error) {
 	return commands, nil
 }
 
-func (b *Bot) setCommands(scope BotCommandScope, commands []command) error {
+func (b *Bot) setCommands(ctx context.Context, scope BotCommandScope, commands []command) error {
 	botCommands := make([]BotCommand, 0, len(commands))
 	for _, cmd := range commands {
 		botCommands = append(botCommands, BotCommand{
@@ -340,7 +751,7 @@ func (b *Bot) setCommands(scope BotCommandScope, commands []command) error {
 		Commands: botCommands,
 	}
 
-	_, err := b.Sender.Send(&smc)
+	_, err := b.Sender.SendWithContext(ctx, &smc)
 	if err != nil {
 		return fmt.Errorf("sending setMyCommands request: %w", err)
 	}
@@ -379,45 +790,81 @@ func isEqualCommands(myCommands []command, telegramCommands []BotCommand) bool {
 	return slices.Equal(mySlice, telegramSlice)
 }
 
-func (b *Bot) work() {
-	var (
-		ctx     Context
-		cmd     string
-		handler HandlerFunc
-		exists  bool
-	)
+func (b *Bot) work(ch <-chan Update, wg *sync.WaitGroup) {
+	defer wg.Done()
 
 	for {
 		select {
 		case <-b.ctx.Done():
 			return
 
-		case upd := <-b.chUpdate:
-			ctx = Context{
-				bot:     b,
-				updType: upd.UpdateType(),
-				upd:     &upd,
-				ctx:     b.ctx,
+		case upd, ok := <-ch:
+			if !ok {
+				return
 			}
+			b.handleUpdate(&upd, nil)
+		}
+	}
+}
 
-			if ctx.UpdateType() == UpdateTypeMessage && upd.Message.IsCommand() {
-				cmd, _ = upd.Message.GetCommand()
+// handleUpdate dispatches the update to its handler, if any, and acknowledges it.
+// If response is non-nil, the first request may be sent in the response to the webhook request
+func (b *Bot) handleUpdate(upd *Update, response *webhookResponse) {
+	ctx := Context{
+		bot:      b,
+		updType:  upd.UpdateType(),
+		upd:      upd,
+		ctx:      b.ctx,
+		response: response,
+	}
 
-				handler, exists = b.commandHandlers.GetHandler(cmd)
-				if exists {
-					b.useHandler(handler, &ctx)
-				}
-			} else {
-				handler, exists = b.updateHandlers[ctx.updType]
-				if exists {
-					b.useHandler(handler, &ctx)
-				}
+	if msg := upd.Message; b.migrations != nil && msg != nil && msg.MigrateToChatId != nil {
+		b.migrations.migrate(msg.Chat.ID, *msg.MigrateToChatId)
+	}
+
+	if handler, exists := b.pickHandler(&ctx); exists {
+		b.useHandler(handler, &ctx)
+	}
+	if ack, ok := b.Receiver.(UpdateAcknowledger); ok {
+		ack.AckUpdate(upd.UpdateID)
+	}
+}
+
+// pickHandler returns the handler assigned to work with the update in ctx, if any
+func (b *Bot) pickHandler(ctx *Context) (HandlerFunc, bool) {
+	if ctx.updType == UpdateTypeMessage && ctx.upd.Message.IsCommand() {
+		cmd, _ := ctx.upd.Message.GetCommand()
+		return b.commandHandlers.GetHandler(cmd)
+	}
+
+	if len(b.stateHandlers) > 0 {
+		if handler, ok := b.stateHandlers[ctx.State()]; ok {
+			return handler, true
+		}
+	}
+
+	switch ctx.updType {
+	case UpdateTypeCallbackQuery:
+		if data := ctx.upd.CallbackQuery.Data; data != nil {
+			handler, params, ok := b.callbackHandlers.GetHandler(*data)
+			if ok {
+				ctx.params = params
+				return handler, true
 			}
 		}
 	}
+
+	router, exists := b.updateHandlers[ctx.updType]
+	if !exists {
+		return nil, false
+	}
+	return router.match(ctx)
 }
 
 func (b *Bot) useHandler(handler HandlerFunc, ctx *Context) {
+	handler = WrapHandler(handler, b.middleware...)
+	handler = Timeout(b.HandlerTimeout)(handler)
+
 	start := time.Now()
 	err := handler(ctx)
 	end := time.Since(start)
@@ -427,4 +874,18 @@ func (b *Bot) useHandler(handler HandlerFunc, ctx *Context) {
 	} else {
 		b.Logger.Info("handled update", "type", ctx.UpdateType(), "ID", ctx.UpdateID(), "duration", end)
 	}
+
+	if ctx.updType == UpdateTypeCallbackQuery && !ctx.answered {
+		b.answerCallbackQuery(ctx)
+	}
+}
+
+// answerCallbackQuery sends an empty answer to the callback query,
+// so the client stops showing the progress bar
+func (b *Bot) answerCallbackQuery(ctx *Context) {
+	// the query must be answered even if the handler has timed out
+	_, err := ctx.SendRequestContext(context.WithoutCancel(ctx.Context()), &AnswerCallbackQuery{CallbackQueryID: ctx.upd.CallbackQuery.Id})
+	if err != nil {
+		b.Logger.Error(err, "answering callback query automatically", "ID", ctx.UpdateID())
+	}
 }
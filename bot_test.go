@@ -0,0 +1,371 @@
+package botify
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBot_MiddlewareOrder(t *testing.T) {
+	var calls []string
+
+	mw := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) error {
+				calls = append(calls, name)
+				return next(ctx)
+			}
+		}
+	}
+
+	b := &Bot{Logger: logr.Discard()}
+	b.Use(mw("global 1"), mw("global 2"))
+	b.Handle(UpdateTypeMessage, func(ctx *Context) error {
+		calls = append(calls, "handler")
+		return nil
+	}, mw("local 1"), mw("local 2"))
+
+	upd := Update{Message: &Message{}}
+	ctx := Context{bot: b, updType: upd.UpdateType(), upd: &upd}
+	handler, _ := b.updateHandlers[UpdateTypeMessage].match(&ctx)
+	b.useHandler(handler, &ctx)
+
+	assert.Equal(t, []string{"global 1", "global 2", "local 1", "local 2", "handler"}, calls)
+}
+
+func TestBot_HandlerMiddleware(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context) error {
+				calls = append(calls, name)
+				return next(ctx)
+			}
+		}
+	}
+	handler := func(ctx *Context) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Logger: logr.Discard()}
+	b.Use(mw("global"))
+	b.With(mw("command 1"), mw("command 2")).HandleCommand("/admin", "Admin panel", handler)
+	b.HandleCallback("item:{id}", handler, mw("callback"))
+	b.HandleState("awaiting_name", handler, mw("state"))
+	b.With(mw("filtered")).HandleFiltered(UpdateTypeMessage, handler, HasPhoto)
+	b.Handle(UpdateTypeMessage, handler)
+	b.init(context.Background())
+
+	user := User{ID: 1}
+	tests := []struct {
+		name      string
+		upd       Update
+		state     string
+		wantCalls []string
+	}{
+		{
+			name:      "command",
+			upd:       Update{Message: &Message{Chat: Chat{ID: 1}, From: &user, Text: strPointer("/admin"), Entities: &[]MessageEntity{{Type: "bot_command", Length: 6}}}},
+			wantCalls: []string{"global", "command 1", "command 2", "handler"},
+		},
+		{
+			name:      "callback",
+			upd:       Update{CallbackQuery: &CallbackQuery{From: user, Data: strPointer("item:1")}},
+			wantCalls: []string{"global", "callback", "handler"},
+		},
+		{
+			name:      "state",
+			upd:       Update{Message: &Message{Chat: Chat{ID: 1}, From: &user, Text: strPointer("Alice")}},
+			state:     "awaiting_name",
+			wantCalls: []string{"global", "state", "handler"},
+		},
+		{
+			name:      "filtered",
+			upd:       Update{Message: &Message{Chat: Chat{ID: 1}, From: &user, Photo: &[]PhotoSize{{}}}},
+			wantCalls: []string{"global", "filtered", "handler"},
+		},
+		{
+			name:      "fallback has none",
+			upd:       Update{Message: &Message{Chat: Chat{ID: 1}, From: &user, Text: strPointer("hi")}},
+			wantCalls: []string{"global", "handler"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			ctx := Context{bot: b, upd: &tt.upd, updType: tt.upd.UpdateType(), ctx: b.ctx}
+			if tt.state != "" {
+				assert.NoError(t, ctx.SetState(tt.state))
+				defer ctx.ClearState()
+			}
+
+			h, ok := b.pickHandler(&ctx)
+			if assert.True(t, ok) {
+				b.useHandler(h, &ctx)
+			}
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestWrapHandler_StopsChain(t *testing.T) {
+	called := false
+	deny := func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) error {
+			return nil
+		}
+	}
+
+	h := WrapHandler(func(ctx *Context) error {
+		called = true
+		return nil
+	}, deny)
+
+	assert.NoError(t, h(&Context{}))
+	assert.False(t, called)
+}
+
+// testSender records every sent request and responds with a successful response.
+// The result is "true", unless Result is set
+type testSender struct {
+	Result []byte
+
+	mu   sync.Mutex
+	sent []APIMethod
+}
+
+func (s *testSender) Send(obj APIMethod) (*APIResponse, error) {
+	return s.SendWithContext(context.Background(), obj)
+}
+
+func (s *testSender) SendWithContext(_ context.Context, obj APIMethod) (*APIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, obj)
+	if s.Result != nil {
+		return &APIResponse{Ok: true, Result: s.Result}, nil
+	}
+	return &APIResponse{Ok: true, Result: []byte("true")}, nil
+}
+
+func (s *testSender) SendJSON(method string, obj any) (*APIResponse, error) {
+	return s.SendJSONWithContext(context.Background(), method, obj)
+}
+
+func (s *testSender) SendJSONWithContext(_ context.Context, _ string, _ any) (*APIResponse, error) {
+	return &APIResponse{Ok: true, Result: []byte("true")}, nil
+}
+
+func (s *testSender) Sent() []APIMethod {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent
+}
+
+// testReceiver sends every update from Updates and waits until it's stopped
+type testReceiver struct {
+	Updates []Update
+	// closed once every update is sent, if not nil
+	Delivered chan struct{}
+}
+
+func (r *testReceiver) PairBot(b *Bot) {
+	b.Receiver = r
+}
+
+func (r *testReceiver) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) error {
+	for _, upd := range r.Updates {
+		select {
+		case chUpdate <- upd:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if r.Delivered != nil {
+		close(r.Delivered)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestBot_Shutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		wantHandled int
+		wantErr     bool
+	}{
+		{name: "every update is handled", timeout: time.Second, wantHandled: 5},
+		{name: "deadline exceeded", timeout: 10 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				handled   atomic.Int32
+				cancelled atomic.Int32
+			)
+
+			rec := &testReceiver{Delivered: make(chan struct{})}
+			for i := range 5 {
+				rec.Updates = append(rec.Updates, Update{UpdateID: i, Message: &Message{}})
+			}
+			sender := &testSender{}
+
+			b := &Bot{Token: "1:token", Sender: sender, Receiver: rec, Logger: logr.Discard(), WorkerPool: 1, ChanSize: 5}
+			b.Handle(UpdateTypeMessage, func(ctx *Context) error {
+				select {
+				case <-time.After(20 * time.Millisecond):
+					handled.Add(1)
+				case <-ctx.Context().Done():
+					cancelled.Add(1)
+				}
+				return nil
+			})
+			b.init(context.Background())
+
+			served := make(chan error)
+			lc := b.start()
+			go func() { served <- b.receive(lc) }()
+			<-rec.Delivered
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := b.Shutdown(ctx)
+			assert.NoError(t, <-served)
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.Less(t, int(handled.Load()), 5)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHandled, int(handled.Load()))
+			assert.Zero(t, cancelled.Load())
+			assert.Empty(t, sender.Sent(), "close must not be sent unless asked")
+		})
+	}
+}
+
+func TestBot_ServeContext(t *testing.T) {
+	type ctxKey struct{}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	defer cancel()
+
+	var (
+		value      any
+		handlerErr error
+	)
+	b := &Bot{
+		Token:    "1:token",
+		Sender:   &testSender{Result: []byte(`{"url":""}`)},
+		Receiver: &testReceiver{Updates: []Update{{Message: &Message{}}}},
+		Logger:   logr.Discard(),
+	}
+	b.Handle(UpdateTypeMessage, func(hctx *Context) error {
+		value = hctx.Value(ctxKey{})
+		cancel()
+		// the handler is given the time to finish its work
+		time.Sleep(10 * time.Millisecond)
+		handlerErr = hctx.Context().Err()
+		return nil
+	})
+
+	assert.NoError(t, b.ServeContext(ctx))
+	assert.Equal(t, "value", value)
+	assert.NoError(t, handlerErr)
+}
+
+func TestBot_ServeContext_CancelledEarly(t *testing.T) {
+	tests := []struct {
+		name     string
+		cancelOn string // the pre-flight request during which ctx is cancelled, or "" if it's cancelled before
+		wantErr  bool
+	}{
+		{name: "before launch", wantErr: true},
+		{name: "while getting webhook info", cancelOn: "getWebhookInfo", wantErr: true},
+		{name: "while setting up commands", cancelOn: "getMyCommands"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelOn == "" {
+				cancel()
+			}
+
+			sender := WrapSender(&testSender{Result: []byte(`{"url":""}`)}, func(next SendFunc) SendFunc {
+				return func(reqCtx context.Context, method string, obj any) (*APIResponse, error) {
+					if method == tt.cancelOn {
+						cancel()
+						<-reqCtx.Done()
+						return nil, reqCtx.Err()
+					}
+					return next(reqCtx, method, obj)
+				}
+			})
+			b := &Bot{Token: "1:token", Sender: sender, Receiver: &testReceiver{}, Logger: logr.Discard()}
+			b.HandleCommand("start", "starts the bot", func(ctx *Context) error { return nil })
+
+			done := make(chan error)
+			go func() { done <- b.ServeContext(ctx) }()
+
+			select {
+			case err := <-done:
+				if tt.wantErr {
+					assert.ErrorIs(t, err, context.Canceled)
+				} else {
+					assert.NoError(t, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("the bot keeps serving once ctx is done")
+			}
+		})
+	}
+}
+
+func TestBot_ServeContext_WebhookIsSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		lp      *LongPolling
+		wantErr bool
+	}{
+		{name: "refuses to start", lp: &LongPolling{}, wantErr: true},
+		{name: "deletes webhook", lp: &LongPolling{DeleteWebhook: true, DropPendingUpdates: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &scriptedSender{script: []scriptedResponse{
+				{Resp: &APIResponse{Ok: true, Result: []byte(`{"url":"https://example.com"}`)}},
+			}}
+			b := &Bot{Token: "1:token", Sender: sender, Receiver: tt.lp, Logger: logr.Discard()}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error)
+			go func() { done <- b.ServeContext(ctx) }()
+
+			if tt.wantErr {
+				assert.Error(t, <-done)
+				return
+			}
+
+			assert.Eventually(t, func() bool { return len(sender.Sent()) > 2 }, time.Second, time.Millisecond)
+			if dwh, ok := sender.Sent()[1].(*DeleteWebhook); assert.True(t, ok) {
+				assert.True(t, dwh.DropPendingUpdates)
+			}
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
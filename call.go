@@ -0,0 +1,58 @@
+package botify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Method is an [APIMethod] which declares the type of its result, see [Call] and [Do].
+// E.g. [SendMessage] is a Method[Message], and [GetMe] is a Method[User].
+type Method[T any] interface {
+	APIMethod
+	// ResultType returns the zero value of the result type.
+	// It's never called, it only binds the method to its result
+	ResultType() T
+}
+
+// Call sends the request with sender and returns its result decoded into T.
+// Unlike [APIResponse.BindResult], unknown fields of the result are ignored,
+// so it keeps working once Telegram adds new fields to the objects.
+// It returns [ErrNoResult] if the response has no result.
+func Call[T any](ctx context.Context, sender RequestSender, m Method[T]) (T, error) {
+	resp, err := sender.SendWithContext(ctx, m)
+	return decodeResult[T](m, resp, err)
+}
+
+// Do sends the request with the bot's [RequestSender], just like [Context.SendRequest],
+// and returns its result decoded into T, just like [Call].
+// Since the result is needed, the request is never written into the webhook response,
+// see [Webhook.ReplyInResponse].
+func Do[T any](ctx *Context, m Method[T]) (T, error) {
+	resp, err := ctx.bot.Sender.SendWithContext(ctx.Context(), m)
+	if err == nil {
+		ctx.checkAnswered(m)
+	}
+	return decodeResult[T](m, resp, err)
+}
+
+func decodeResult[T any](m APIMethod, resp *APIResponse, err error) (T, error) {
+	var result T
+	if err != nil {
+		return result, err
+	}
+	if resp == nil {
+		return result, fmt.Errorf("%s: no response", m.APIEndpoint())
+	}
+	if err = resp.GetError(); err != nil {
+		return result, err
+	}
+	if len(resp.Result) == 0 {
+		return result, fmt.Errorf("%s: %w", m.APIEndpoint(), ErrNoResult)
+	}
+
+	if err = json.Unmarshal(resp.Result, &result); err != nil {
+		return result, fmt.Errorf("decoding %s result: %w", m.APIEndpoint(), err)
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package botify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Method[Message]       = SendMessage{}
+	_ Method[[]MessageId]   = ForwardMessages{}
+	_ Method[EditedMessage] = EditMessageText{}
+	_ Method[User]          = GetMe
+	_ Method[bool]          = LogOut
+)
+
+func TestCall(t *testing.T) {
+	ctx := context.Background()
+
+	sender := &testSender{Result: []byte(`{"message_id":2,"date":0,"chat":{"id":1,"type":"private"},"some_new_field":true}`)}
+	msg, err := Call(ctx, sender, &SendMessage{ChatID: "1", Text: "hi"})
+	assert.NoError(t, err, "unknown fields are ignored")
+	assert.Equal(t, 2, msg.MessageId)
+	assert.Equal(t, int64(1), msg.Chat.ID)
+
+	sender = &testSender{Result: []byte(`{"id":1,"is_bot":true,"first_name":"bot"}`)}
+	me, err := Call(ctx, sender, GetMe)
+	assert.NoError(t, err)
+	assert.True(t, me.IsBot)
+
+	sender = &testSender{Result: []byte(`[{"message_id":3},{"message_id":4}]`)}
+	ids, err := Call(ctx, sender, &ForwardMessages{ChatID: "1", FromChatID: "2", MessageIDs: []int{1, 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, []MessageId{{3}, {4}}, ids)
+
+	sender = &testSender{Result: []byte(`true`)}
+	edited, err := Call(ctx, sender, &EditMessageText{InlineMessageID: "1", Text: "edited"})
+	assert.NoError(t, err)
+	assert.Nil(t, edited.Message, "inline messages are not returned")
+
+	sender = &testSender{Result: []byte(`"not a message"`)}
+	_, err = Call(ctx, sender, &SendMessage{ChatID: "1", Text: "hi"})
+	assert.ErrorContains(t, err, "decoding sendMessage result")
+}
+
+func TestDo(t *testing.T) {
+	sender := &testSender{Result: []byte(`{"message_id":2,"date":0,"chat":{"id":1,"type":"private"}}`)}
+	b := &Bot{Token: "1:token", Sender: sender}
+	ctx := &Context{bot: b, upd: &Update{}, ctx: context.Background()}
+
+	msg, err := Do(ctx, &SendMessage{ChatID: "1", Text: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, msg.MessageId)
+
+	// never written into the webhook response, since the result is needed
+	ctx.response = &webhookResponse{}
+	msg, err = Do(ctx, &SendMessage{ChatID: "1", Text: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, msg.MessageId)
+	assert.Len(t, sender.Sent(), 2)
+	assert.Nil(t, ctx.response.body)
+
+	// the result is never made up
+	b.Sender = WrapSender(sender, func(next SendFunc) SendFunc {
+		return func(ctx context.Context, method string, obj any) (*APIResponse, error) {
+			return &APIResponse{Ok: true}, nil
+		}
+	})
+	_, err = Do(ctx, &SendMessage{ChatID: "1", Text: "hi"})
+	assert.ErrorIs(t, err, ErrNoResult)
+}
@@ -0,0 +1,83 @@
+package botify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// to avoid overloading the API, this types remains private
+
+type callbackHandler struct {
+	Pattern *regexp.Regexp
+	Handler HandlerFunc
+}
+
+type callbackRegistry struct {
+	handlers []callbackHandler
+}
+
+// compileCallbackPattern turns pattern like "item:{id}:delete" into an anchored regular expression,
+// where every {name} placeholder is a named group matching one or more characters except ':'
+func compileCallbackPattern(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	rest := pattern
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start == -1 {
+			sb.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("unclosed placeholder in callback pattern %q", pattern)
+		}
+		end += start
+
+		name := rest[start+1 : end]
+		if name == "" {
+			return nil, fmt.Errorf("empty placeholder name in callback pattern %q", pattern)
+		}
+
+		sb.WriteString(regexp.QuoteMeta(rest[:start]))
+		sb.WriteString("(?P<" + name + ">[^:]+)")
+		rest = rest[end+1:]
+	}
+
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func (r *callbackRegistry) AddHandler(pattern string, handler HandlerFunc) error {
+	re, err := compileCallbackPattern(pattern)
+	if err != nil {
+		return err
+	}
+	r.handlers = append(r.handlers, callbackHandler{Pattern: re, Handler: handler})
+	return nil
+}
+
+// GetHandler returns the first handler whose pattern matches data and parameters extracted from data
+func (r *callbackRegistry) GetHandler(data string) (HandlerFunc, map[string]string, bool) {
+	for _, h := range r.handlers {
+		match := h.Pattern.FindStringSubmatch(data)
+		if match == nil {
+			continue
+		}
+
+		params := make(map[string]string, len(match)-1)
+		for i, name := range h.Pattern.SubexpNames() {
+			if name != "" {
+				params[name] = match[i]
+			}
+		}
+		return h.Handler, params, true
+	}
+	return nil, nil, false
+}
+
+func (r *callbackRegistry) Len() int {
+	return len(r.handlers)
+}
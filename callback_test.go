@@ -0,0 +1,80 @@
+package botify
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallbackRegistry_GetHandler(t *testing.T) {
+	var r callbackRegistry
+	assert.NoError(t, r.AddHandler("item:{id}:delete", func(ctx *Context) error { return nil }))
+	assert.NoError(t, r.AddHandler("page.{n}", func(ctx *Context) error { return nil }))
+	assert.Error(t, r.AddHandler("item:{id", func(ctx *Context) error { return nil }))
+	assert.Error(t, r.AddHandler("item:{}", func(ctx *Context) error { return nil }))
+
+	testcases := []struct {
+		Name   string
+		Input  string
+		Params map[string]string
+		Ok     bool
+	}{
+		{"match with param", "item:42:delete", map[string]string{"id": "42"}, true},
+		{"dot is not a wildcard", "pageX5", nil, false},
+		{"literal dot", "page.5", map[string]string{"n": "5"}, true},
+		{"param doesn't cross separator", "item:4:2:delete", nil, false},
+		{"empty param", "item::delete", nil, false},
+		{"no match", "item:42:edit", nil, false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, params, ok := r.GetHandler(tc.Input)
+			assert.Equal(t, tc.Ok, ok)
+			assert.Equal(t, tc.Params, params)
+		})
+	}
+}
+
+func TestBot_HandleCallback_AutoAnswer(t *testing.T) {
+	testcases := []struct {
+		Name        string
+		Answer      bool
+		AnswerCount int
+	}{
+		{"handler doesn't answer", false, 1},
+		{"handler answers", true, 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			sender := &testSender{}
+			b := &Bot{Token: "1:token", Sender: sender, Logger: logr.Discard()}
+
+			var id string
+			b.HandleCallback("item:{id}:delete", func(ctx *Context) error {
+				id = ctx.Param("id")
+				if tc.Answer {
+					_, err := ctx.SendRequest(&AnswerCallbackQuery{CallbackQueryID: "query", Text: "deleted"})
+					return err
+				}
+				return nil
+			})
+			b.init(context.Background())
+
+			upd := Update{CallbackQuery: &CallbackQuery{Id: "query", Data: strPointer("item:7:delete")}}
+			ctx := Context{bot: b, upd: &upd, updType: upd.UpdateType(), ctx: b.ctx}
+
+			handler, ok := b.pickHandler(&ctx)
+			if !assert.True(t, ok) {
+				t.FailNow()
+			}
+			b.useHandler(handler, &ctx)
+
+			assert.Equal(t, "7", id)
+			assert.Len(t, sender.Sent(), tc.AnswerCount)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package botify
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		wantDNS []string
+		wantIPs []net.IP
+	}{
+		{name: "domain", host: "example.com", wantDNS: []string{"example.com"}},
+		{name: "ip", host: "203.0.113.7", wantIPs: []net.IP{net.ParseIP("203.0.113.7").To4()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := generateCertificate(tt.host)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			block, _ := pem.Decode(cert.pem)
+			if !assert.NotNil(t, block) {
+				t.FailNow()
+			}
+			parsed, err := x509.ParseCertificate(block.Bytes)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			assert.Equal(t, tt.host, parsed.Subject.CommonName)
+			assert.Equal(t, tt.wantDNS, parsed.DNSNames)
+			for i, ip := range tt.wantIPs {
+				assert.True(t, ip.Equal(parsed.IPAddresses[i]))
+			}
+			assert.Equal(t, block.Bytes, cert.tls.Certificate[0])
+		})
+	}
+}
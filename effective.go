@@ -0,0 +1,175 @@
+package botify
+
+// MessageSender is the one on whose behalf the update was sent.
+// Chat is non-nil if the message was sent on behalf of a chat,
+// e.g. by an anonymous group administrator, a channel or a linked channel,
+// in that case User, if any, is a placeholder user provided by Telegram.
+type MessageSender struct {
+	User *User
+	Chat *Chat
+}
+
+// ID returns the identifier of the chat if the update was sent on behalf of it,
+// otherwise the identifier of the user.
+func (s MessageSender) ID() int64 {
+	if s.Chat != nil {
+		return s.Chat.ID
+	}
+	if s.User != nil {
+		return int64(s.User.ID)
+	}
+	return 0
+}
+
+// IsChat reports whether the update was sent on behalf of a chat.
+func (s MessageSender) IsChat() bool {
+	return s.Chat != nil
+}
+
+// message returns the first non-nil message of any kind, sent with the update itself
+func (u *Update) message() *Message {
+	switch {
+	case u.Message != nil:
+		return u.Message
+	case u.EditedMessage != nil:
+		return u.EditedMessage
+	case u.ChannelPost != nil:
+		return u.ChannelPost
+	case u.EditedChannelPost != nil:
+		return u.EditedChannelPost
+	case u.BusinessMessage != nil:
+		return u.BusinessMessage
+	case u.EditedBusinessMessage != nil:
+		return u.EditedBusinessMessage
+	}
+	return nil
+}
+
+// EffectiveMessage returns the message the update is about:
+// any kind of new or edited message, or the message with the inline keyboard for callback queries.
+// The message attached to a callback query may be inaccessible, see [MaybeInaccessibleMessage].
+// It returns nil if there's no such message.
+func (u *Update) EffectiveMessage() *Message {
+	if msg := u.message(); msg != nil {
+		return msg
+	}
+	if u.CallbackQuery != nil && u.CallbackQuery.Message != nil {
+		return (*Message)(u.CallbackQuery.Message)
+	}
+	return nil
+}
+
+// EffectiveChat returns the chat where the update has happened.
+// It returns nil if there's no such chat, e.g. for inline queries.
+func (u *Update) EffectiveChat() *Chat {
+	if msg := u.EffectiveMessage(); msg != nil {
+		return &msg.Chat
+	}
+
+	switch {
+	case u.DeletedBusinessMessages != nil:
+		return &u.DeletedBusinessMessages.Chat
+	case u.MessageReaction != nil:
+		return &u.MessageReaction.Chat
+	case u.MessageReactionCount != nil:
+		return &u.MessageReactionCount.Chat
+	case u.MyChatMember != nil:
+		return &u.MyChatMember.Chat
+	case u.ChatMember != nil:
+		return &u.ChatMember.Chat
+	case u.ChatJoinRequest != nil:
+		return &u.ChatJoinRequest.Chat
+	case u.ChatBoost != nil:
+		return &u.ChatBoost.Chat
+	case u.RemovedChatBoost != nil:
+		return &u.RemovedChatBoost.Chat
+	}
+	return nil
+}
+
+// EffectiveUser returns the user who has caused the update.
+// For callback queries it's the user who has pressed the button, not the author of the message.
+// It returns nil if there's no such user, e.g. for channel posts or anonymous reactions.
+func (u *Update) EffectiveUser() *User {
+	switch {
+	case u.CallbackQuery != nil:
+		return &u.CallbackQuery.From
+	case u.InlineQuery != nil:
+		return &u.InlineQuery.From
+	case u.ChosenInlineResult != nil:
+		return &u.ChosenInlineResult.From
+	case u.ShippingQuery != nil:
+		return &u.ShippingQuery.From
+	case u.PreCheckoutQuery != nil:
+		return u.PreCheckoutQuery.From
+	case u.PurchasedPaidMedia != nil:
+		return &u.PurchasedPaidMedia.User
+	case u.PollAnswer != nil:
+		return u.PollAnswer.User
+	case u.BusinessConnection != nil:
+		return &u.BusinessConnection.User
+	case u.MessageReaction != nil:
+		return u.MessageReaction.User
+	case u.MyChatMember != nil:
+		return &u.MyChatMember.From
+	case u.ChatMember != nil:
+		return &u.ChatMember.From
+	case u.ChatJoinRequest != nil:
+		return &u.ChatJoinRequest.User
+	case u.ChatBoost != nil:
+		return u.ChatBoost.Boost.Source.User
+	case u.RemovedChatBoost != nil:
+		return u.RemovedChatBoost.Source.User
+	}
+
+	if msg := u.message(); msg != nil {
+		return msg.From
+	}
+	return nil
+}
+
+// EffectiveSender returns the one on whose behalf the update was sent.
+// Unlike [Update.EffectiveUser], it takes into account the messages, reactions and poll answers
+// sent on behalf of a chat. It returns nil if there's no sender at all.
+func (u *Update) EffectiveSender() *MessageSender {
+	var chat *Chat
+
+	switch {
+	case u.MessageReaction != nil:
+		chat = u.MessageReaction.ActorChat
+	case u.PollAnswer != nil:
+		chat = u.PollAnswer.VoterChat
+	case u.CallbackQuery != nil:
+		// the message belongs to the bot, not to the one who has pressed the button
+	default:
+		if msg := u.message(); msg != nil {
+			chat = msg.SenderChat
+		}
+	}
+
+	user := u.EffectiveUser()
+	if user == nil && chat == nil {
+		return nil
+	}
+	return &MessageSender{User: user, Chat: chat}
+}
+
+// EffectiveMessage is a shortcut for [Update.EffectiveMessage]
+func (c *Context) EffectiveMessage() *Message {
+	return c.upd.EffectiveMessage()
+}
+
+// EffectiveChat is a shortcut for [Update.EffectiveChat]
+func (c *Context) EffectiveChat() *Chat {
+	return c.upd.EffectiveChat()
+}
+
+// EffectiveUser is a shortcut for [Update.EffectiveUser]
+func (c *Context) EffectiveUser() *User {
+	return c.upd.EffectiveUser()
+}
+
+// EffectiveSender is a shortcut for [Update.EffectiveSender]
+func (c *Context) EffectiveSender() *MessageSender {
+	return c.upd.EffectiveSender()
+}
@@ -0,0 +1,143 @@
+package botify
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+const (
+	ChatTypePrivate    = "private"
+	ChatTypeGroup      = "group"
+	ChatTypeSupergroup = "supergroup"
+	ChatTypeChannel    = "channel"
+)
+
+// Filter reports whether the update in ctx should be handled by the handler it is assigned to.
+// See [Router] and [Bot.HandleFiltered].
+type Filter func(ctx *Context) bool
+
+// And matches the update if every filter matches it.
+func And(filters ...Filter) Filter {
+	return func(ctx *Context) bool {
+		return matchAll(ctx, filters)
+	}
+}
+
+// Or matches the update if at least one of the filters matches it.
+func Or(filters ...Filter) Filter {
+	return func(ctx *Context) bool {
+		for _, f := range filters {
+			if f(ctx) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not inverts the filter.
+func Not(filter Filter) Filter {
+	return func(ctx *Context) bool {
+		return !filter(ctx)
+	}
+}
+
+// ChatType matches updates from the chats of the given types,
+// e.g. [ChatTypePrivate] or [ChatTypeSupergroup].
+// See [Context.EffectiveChat].
+func ChatType(types ...string) Filter {
+	return func(ctx *Context) bool {
+		chat := ctx.EffectiveChat()
+		return chat != nil && slices.Contains(types, chat.Type)
+	}
+}
+
+// ChatID matches updates from the chats with the given identifiers.
+// See [Context.EffectiveChat].
+func ChatID(ids ...int64) Filter {
+	return func(ctx *Context) bool {
+		chat := ctx.EffectiveChat()
+		return chat != nil && slices.Contains(ids, chat.ID)
+	}
+}
+
+// FromUser matches updates caused by the users with the given identifiers.
+// See [Context.EffectiveUser].
+func FromUser(ids ...int) Filter {
+	return func(ctx *Context) bool {
+		user := ctx.EffectiveUser()
+		return user != nil && slices.Contains(ids, user.ID)
+	}
+}
+
+// TextMatches matches messages whose text or caption matches re.
+func TextMatches(re *regexp.Regexp) Filter {
+	return func(ctx *Context) bool {
+		msg := ctx.upd.message()
+		if msg == nil {
+			return false
+		}
+		if msg.Text != nil {
+			return re.MatchString(*msg.Text)
+		}
+		if msg.Caption != nil {
+			return re.MatchString(*msg.Caption)
+		}
+		return false
+	}
+}
+
+// HasPhoto matches messages with a photo.
+func HasPhoto(ctx *Context) bool {
+	msg := ctx.upd.message()
+	return msg != nil && msg.Photo != nil && len(*msg.Photo) != 0
+}
+
+// IsReplyToBot matches messages which are replies to the messages sent by this bot.
+func IsReplyToBot(ctx *Context) bool {
+	msg := ctx.upd.message()
+	if msg == nil || msg.ReplyToMessage == nil || msg.ReplyToMessage.From == nil {
+		return false
+	}
+	id, ok := ctx.bot.id()
+	return ok && msg.ReplyToMessage.From.ID == id
+}
+
+// FromAdmin matches updates caused by the creator or an administrator of the chat.
+// Anonymous administrators, sending messages on behalf of the group itself, are matched too.
+// It sends a /getChatMember request every time it's called,
+// so it's better to put it after the cheaper filters.
+// Any request error is treated as a mismatch.
+func FromAdmin(ctx *Context) bool {
+	chat := ctx.EffectiveChat()
+	if chat == nil || chat.Type == ChatTypePrivate {
+		return false
+	}
+	if sender := ctx.EffectiveSender(); sender != nil && sender.IsChat() && sender.Chat.ID == chat.ID {
+		return true
+	}
+	user := ctx.EffectiveUser()
+	if user == nil {
+		return false
+	}
+
+	resp, err := ctx.SendRequest(&GetChatMember{
+		ChatID: strconv.FormatInt(chat.ID, 10),
+		UserID: user.ID,
+	})
+	if err != nil {
+		ctx.bot.Logger.Error(err, "checking if user is an administrator", "chat", chat.ID, "user", user.ID)
+		return false
+	}
+
+	// only the status matters here
+	var member struct {
+		Status string `json:"status"`
+	}
+	if err = json.Unmarshal(resp.Result, &member); err != nil {
+		return false
+	}
+	return member.Status == "creator" || member.Status == "administrator"
+}
@@ -0,0 +1,120 @@
+package botify
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// TelegramSubnets are the subnets Telegram sends webhook requests from,
+// see [Webhook.AllowTelegramIPsOnly].
+var TelegramSubnets = []netip.Prefix{
+	netip.MustParsePrefix("149.154.160.0/20"),
+	netip.MustParsePrefix("91.108.4.0/22"),
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing subnet %s: %w", cidr, err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address the request came from.
+// X-Forwarded-For header is used only if the request came from one of the trusted proxies,
+// in that case it's the rightmost address which doesn't belong to them
+func clientAddr(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	if !containsAddr(trusted, addr) {
+		return addr, true
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return addr, true
+	}
+
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		if !containsAddr(trusted, hop) {
+			return hop, true
+		}
+		addr = hop
+	}
+	// every hop is trusted
+	return addr, true
+}
+
+// recentIDs remembers a limited number of the most recent update IDs
+type recentIDs struct {
+	mu   sync.Mutex
+	set  map[int]struct{}
+	ring []int
+	next int
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{
+		set:  make(map[int]struct{}, size),
+		ring: make([]int, 0, size),
+	}
+}
+
+// add remembers the ID, forgetting the oldest one if needed.
+// It returns false if the ID is already remembered
+func (r *recentIDs) add(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.set[id]; ok {
+		return false
+	}
+
+	if len(r.ring) < cap(r.ring) {
+		r.ring = append(r.ring, id)
+	} else {
+		delete(r.set, r.ring[r.next])
+		r.ring[r.next] = id
+		r.next = (r.next + 1) % len(r.ring)
+	}
+	r.set[id] = struct{}{}
+	return true
+}
+
+// remove forgets the ID, so it's accepted again
+func (r *recentIDs) remove(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.set, id)
+}
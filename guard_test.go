@@ -0,0 +1,62 @@
+package botify
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAddr(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+		wantOk    bool
+	}{
+		{name: "no proxy", remote: "1.2.3.4:1234", want: "1.2.3.4", wantOk: true},
+		{name: "header from untrusted peer is ignored", remote: "1.2.3.4:1234", forwarded: []string{"5.6.7.8"}, want: "1.2.3.4", wantOk: true},
+		{name: "trusted proxy", remote: "10.0.0.1:1234", forwarded: []string{"5.6.7.8"}, want: "5.6.7.8", wantOk: true},
+		{name: "spoofed hops are skipped", remote: "10.0.0.1:1234", forwarded: []string{"9.9.9.9, 5.6.7.8, 10.0.0.2"}, want: "5.6.7.8", wantOk: true},
+		{name: "several headers", remote: "10.0.0.1:1234", forwarded: []string{"9.9.9.9", "5.6.7.8"}, want: "5.6.7.8", wantOk: true},
+		{name: "trusted proxy without header", remote: "10.0.0.1:1234", want: "10.0.0.1", wantOk: true},
+		{name: "invalid hop", remote: "10.0.0.1:1234", forwarded: []string{"unknown"}},
+		{name: "ipv4-mapped ipv6", remote: "[::ffff:1.2.3.4]:1234", want: "::ffff:1.2.3.4", wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			addr, ok := clientAddr(r, trusted)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				assert.Equal(t, tt.want, addr.String())
+			}
+		})
+	}
+}
+
+func TestRecentIDs(t *testing.T) {
+	ids := newRecentIDs(2)
+
+	assert.True(t, ids.add(1))
+	assert.True(t, ids.add(2))
+	assert.False(t, ids.add(1))
+
+	// 1 is the oldest one
+	assert.True(t, ids.add(3))
+	assert.True(t, ids.add(1))
+	assert.False(t, ids.add(3))
+
+	ids.remove(3)
+	assert.True(t, ids.add(3))
+}
@@ -2,6 +2,7 @@ package reused
 
 import (
 	"bytes"
+	"regexp"
 	"sync"
 
 	"github.com/go-playground/validator/v10"
@@ -33,9 +34,15 @@ var (
 	once  sync.Once
 )
 
+// only A-Z, a-z, 0-9, _ and - are allowed in the webhook secret token
+var secretToken = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 func Validator() *validator.Validate {
 	once.Do(func() {
 		valid = validator.New(validator.WithRequiredStructEnabled())
+		valid.RegisterValidation("secret_token", func(fl validator.FieldLevel) bool {
+			return secretToken.MatchString(fl.Field().String())
+		})
 	})
 	return valid
 }
@@ -0,0 +1,334 @@
+package botify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// BotManager hosts many bots behind one webhook server.
+// Every bot receives updates with its own [Webhook] with no server of its own,
+// and the requests are routed to them by [Webhook.SecretToken] or, if the bot has none, by [Webhook.Path].
+// The bots can be added and removed while the manager is running.
+// It is ready to use with its zero value.
+type BotManager struct {
+	// In format https://example.com.
+	// Used for every bot whose webhook has no Host of its own
+	Host string
+	// Will be send to the Telegram Bot API server for every bot whose webhook has no ExposedPort of its own.
+	// Defaults to 443
+	ExposedPort string
+	// Will be used to run the server.
+	// Defaults to :443
+	ListenAddr string
+	// Paths to the certificate and its private key used to serve HTTPS.
+	// If empty, the server serves plain HTTP, which is useful only behind a reverse proxy terminating TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// If true, no server is created, and the requests are received by the BotManager itself,
+	// mounted as an [http.Handler] on the server of your own. ListenAddr is ignored in that case
+	DisableServer bool
+	// HTTP Client shared by the [TGBotAPIRequestSender] of every bot which has no client of its own.
+	// Only the bots with no sender or with a bare *TGBotAPIRequestSender get it:
+	// the senders wrapped with [WrapSender] or [RateLimitedSender] keep their own clients.
+	// Defaults to a client optimised for keeping connection alive
+	Client *http.Client
+	// Logs info about the server and the bots.
+	// Every bot with no logger of its own uses it too.
+	// Defaults to [logr.Discard()]
+	Logger logr.Logger
+	// Called when the bot stops with an error, e.g. because its token was revoked.
+	// The bot is removed from the manager before the call
+	OnBotError func(b *Bot, err error)
+
+	mu       sync.RWMutex
+	bots     map[string]*managedBot // by token
+	byPath   map[string]*managedBot
+	bySecret map[string]*managedBot
+	ctx      context.Context
+}
+
+type managedBot struct {
+	bot     *Bot
+	webhook *Webhook
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Add adds the bot to the manager and, if the manager is running, starts serving it.
+// The bot's receiver must be either nil or a [Webhook],
+// in which case [Webhook.DisableServer] is forced.
+// If the receiver is nil, a webhook with the path "/<bot ID>" is used.
+// The bots with no secret token must have different paths,
+// and the bots with a secret token must have different secret tokens.
+func (m *BotManager) Add(b *Bot) error {
+	if b.Token == "" {
+		return fmt.Errorf("API token must not be empty")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.bots == nil {
+		m.bots = make(map[string]*managedBot)
+		m.byPath = make(map[string]*managedBot)
+		m.bySecret = make(map[string]*managedBot)
+	}
+	if _, ok := m.bots[b.Token]; ok {
+		return fmt.Errorf("bot %s is already added", botID(b.Token))
+	}
+
+	wh, err := m.prepare(b)
+	if err != nil {
+		return err
+	}
+
+	routes, key := m.byPath, wh.Path
+	if wh.SecretToken != "" {
+		routes, key = m.bySecret, wh.SecretToken
+	}
+	if _, ok := routes[key]; ok {
+		if wh.SecretToken != "" {
+			return fmt.Errorf("bot %s: secret token is used by another bot", botID(b.Token))
+		}
+		return fmt.Errorf("bot %s: path %s is used by another bot", botID(b.Token), wh.Path)
+	}
+
+	mb := &managedBot{bot: b, webhook: wh}
+	m.bots[b.Token] = mb
+	routes[key] = mb
+
+	if m.ctx != nil {
+		m.start(mb)
+	}
+	return nil
+}
+
+// prepare makes the bot receive the updates with the webhook with no server, m.mu must be held
+func (m *BotManager) prepare(b *Bot) (*Webhook, error) {
+	var wh *Webhook
+	switch r := b.Receiver.(type) {
+	case nil:
+		wh = &Webhook{Path: "/" + botID(b.Token)}
+	case *Webhook:
+		wh = r
+	default:
+		return nil, fmt.Errorf("bot %s: only webhook can be used with the bot manager, got %T", botID(b.Token), r)
+	}
+
+	wh.DisableServer = true
+	if wh.Host == "" {
+		wh.Host = m.Host
+	}
+	if wh.ExposedPort == "" {
+		wh.ExposedPort = m.ExposedPort
+	}
+	// it must not change once the requests are routed by it
+	if !strings.HasPrefix(wh.Path, "/") {
+		wh.Path = "/" + wh.Path
+	}
+	b.Receiver = wh
+
+	if m.Client == nil {
+		m.Client = defaultClient()
+	}
+	switch s := b.Sender.(type) {
+	case nil:
+		b.Sender = &TGBotAPIRequestSender{Client: m.Client, APIToken: b.Token}
+	case *TGBotAPIRequestSender:
+		if s.Client == nil {
+			s.Client = m.Client
+		}
+	default:
+		m.Logger.Info("the bot's sender is not a TGBotAPIRequestSender, so it doesn't share the manager's HTTP client",
+			"bot", botID(b.Token), "sender", fmt.Sprintf("%T", s))
+	}
+
+	if b.Logger.GetSink() == nil && m.Logger.GetSink() != nil {
+		b.Logger = m.Logger.WithValues("bot", botID(b.Token))
+	}
+	return wh, nil
+}
+
+// Remove stops serving the bot with the given token and removes it from the manager.
+// It waits for the bot to shut down, which takes no longer than [Bot.ShutdownTimeout], if it's set,
+// and returns false if there was no such bot.
+func (m *BotManager) Remove(token string) bool {
+	m.mu.Lock()
+	mb, ok := m.bots[token]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+	m.forget(mb)
+	cancel, done := mb.cancel, mb.done
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return true
+}
+
+// forget removes every route to the bot, m.mu must be held
+func (m *BotManager) forget(mb *managedBot) {
+	delete(m.bots, mb.bot.Token)
+	if mb.webhook.SecretToken != "" {
+		delete(m.bySecret, mb.webhook.SecretToken)
+	} else {
+		delete(m.byPath, mb.webhook.Path)
+	}
+}
+
+// Bots returns every bot added to the manager.
+func (m *BotManager) Bots() []*Bot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	bots := make([]*Bot, 0, len(m.bots))
+	for _, mb := range m.bots {
+		bots = append(bots, mb.bot)
+	}
+	return bots
+}
+
+// start runs the bot until it's removed or the manager stops, m.mu must be held
+func (m *BotManager) start(mb *managedBot) {
+	var ctx context.Context
+	ctx, mb.cancel = context.WithCancel(m.ctx)
+	mb.done = make(chan struct{})
+
+	go func() {
+		defer close(mb.done)
+
+		err := mb.bot.ServeContext(ctx)
+		if err == nil || ctx.Err() != nil {
+			// removed or stopped along with the manager
+			return
+		}
+
+		m.mu.Lock()
+		if m.bots[mb.bot.Token] == mb {
+			m.forget(mb)
+		}
+		m.mu.Unlock()
+
+		m.Logger.Error(err, "bot has stopped", "bot", botID(mb.bot.Token))
+		if m.OnBotError != nil {
+			m.OnBotError(mb.bot, err)
+		}
+	}()
+}
+
+// ServeContext starts serving every added bot and, unless [BotManager.DisableServer] is set,
+// runs the server receiving their updates.
+// Once ctx is done, it stops the server, gracefully shuts down every bot and returns nil.
+func (m *BotManager) ServeContext(ctx context.Context) error {
+	m.mu.Lock()
+	if m.ctx != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("bot manager is already running")
+	}
+	if m.Logger.GetSink() == nil {
+		m.Logger = logr.Discard()
+	}
+	m.ctx = ctx
+	for _, mb := range m.bots {
+		m.start(mb)
+	}
+	m.mu.Unlock()
+
+	var err error
+	if m.DisableServer {
+		<-ctx.Done()
+	} else {
+		err = m.listenAndServe(ctx)
+	}
+
+	m.mu.Lock()
+	m.ctx = nil
+	running := make([]*managedBot, 0, len(m.bots))
+	for _, mb := range m.bots {
+		running = append(running, mb)
+	}
+	m.mu.Unlock()
+
+	for _, mb := range running {
+		mb.cancel()
+		<-mb.done
+	}
+	return err
+}
+
+func (m *BotManager) listenAndServe(ctx context.Context) error {
+	if m.ListenAddr == "" {
+		m.ListenAddr = ":443"
+	}
+	server := &http.Server{
+		Addr:    m.ListenAddr,
+		Handler: m,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		m.Logger.Info("bot manager is listening and serving on", "address", m.ListenAddr)
+
+		var err error
+		if m.TLSCertFile != "" || m.TLSKeyFile != "" {
+			err = server.ListenAndServeTLS(m.TLSCertFile, m.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		m.Logger.Info("stopping bot manager server")
+	case err := <-serverErr:
+		m.Logger.Error(err, "server error")
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		m.Logger.Error(err, "error shutting down bot manager server")
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP routes the request to the webhook of the bot,
+// so the BotManager can be mounted on the server of your own, see [BotManager.DisableServer].
+// It responds with 404 Not Found if there's no such bot.
+func (m *BotManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	mb, ok := m.bySecret[r.Header.Get("X-Telegram-Bot-Api-Secret-Token")]
+	if !ok || mb.webhook.Path != r.URL.Path {
+		mb, ok = m.byPath[r.URL.Path]
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	mb.webhook.ServeHTTP(w, r)
+}
+
+// botID returns the part of the token before the colon, which is the bot's user ID
+func botID(token string) string {
+	id, _, _ := strings.Cut(token, ":")
+	return id
+}
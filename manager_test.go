@@ -0,0 +1,138 @@
+package botify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotManager(t *testing.T) {
+	m := &BotManager{Host: "https://example.com", DisableServer: true}
+
+	received := make(chan string, 2)
+	newBot := func(token string, wh *Webhook) (*Bot, *testSender) {
+		sender := &testSender{Result: []byte(`{"url":""}`)}
+		b := &Bot{Token: token, Sender: sender, WorkerPool: 1}
+		if wh != nil {
+			b.Receiver = wh
+		}
+		b.Handle(UpdateTypeMessage, func(ctx *Context) error {
+			received <- token
+			return nil
+		})
+		return b, sender
+	}
+
+	first, firstSender := newBot("1:first", nil)
+	second, secondSender := newBot("2:second", &Webhook{Path: "webhook", SecretToken: "secret"})
+	assert.NoError(t, m.Add(first))
+	assert.NoError(t, m.Add(second))
+	assert.Error(t, m.Add(first), "added twice")
+	third, _ := newBot("3:third", &Webhook{Path: "/1"})
+	assert.Error(t, m.Add(third), "path is taken")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- m.ServeContext(ctx) }()
+
+	// getWebhookInfo and setWebhook
+	assert.Eventually(t, func() bool { return len(firstSender.Sent()) == 2 && len(secondSender.Sent()) == 2 }, time.Second, time.Millisecond)
+	if swh, ok := firstSender.Sent()[1].(*SetWebhook); assert.True(t, ok) {
+		assert.Equal(t, "https://example.com/1", swh.URL)
+	}
+	if swh, ok := secondSender.Sent()[1].(*SetWebhook); assert.True(t, ok) {
+		assert.Equal(t, "https://example.com/webhook", swh.URL)
+	}
+
+	post := func(path, token string) int {
+		body := `{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("/1", ""))
+	assert.Equal(t, "1:first", <-received)
+	assert.Equal(t, http.StatusOK, post("/webhook", "secret"))
+	assert.Equal(t, "2:second", <-received)
+	assert.Equal(t, http.StatusNotFound, post("/webhook", "wrong"))
+	assert.Equal(t, http.StatusNotFound, post("/unknown", "secret"))
+
+	assert.True(t, m.Remove("1:first"))
+	assert.False(t, m.Remove("1:first"))
+	assert.Equal(t, http.StatusNotFound, post("/1", ""))
+	assert.Len(t, m.Bots(), 1)
+
+	// added while the manager is running
+	assert.NoError(t, m.Add(third))
+	assert.Eventually(t, func() bool { return post("/1", "") == http.StatusOK }, time.Second, time.Millisecond)
+	assert.Equal(t, "3:third", <-received)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestBotManager_OnBotError(t *testing.T) {
+	failed := make(chan error, 1)
+	m := &BotManager{
+		Host:          "https://example.com",
+		DisableServer: true,
+		OnBotError:    func(b *Bot, err error) { failed <- err },
+	}
+
+	sender := &scriptedSender{script: []scriptedResponse{
+		{Resp: &APIResponse{Ok: false, ErrorCode: 401, Description: "Unauthorized"}},
+	}}
+	assert.NoError(t, m.Add(&Bot{Token: "1:revoked", Sender: sender}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.ServeContext(ctx)
+
+	var unauthorized UnauthorizedError
+	assert.ErrorAs(t, <-failed, &unauthorized)
+	assert.Empty(t, m.Bots())
+}
+
+func TestBotManager_RemoveStarting(t *testing.T) {
+	failed := make(chan error, 1)
+	m := &BotManager{
+		Host:          "https://example.com",
+		DisableServer: true,
+		OnBotError:    func(b *Bot, err error) { failed <- err },
+	}
+
+	// the bot is removed while it's getting the webhook info
+	started := make(chan struct{})
+	sender := WrapSender(&testSender{}, func(next SendFunc) SendFunc {
+		return func(ctx context.Context, method string, obj any) (*APIResponse, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+	})
+	assert.NoError(t, m.Add(&Bot{Token: "1:token", Sender: sender}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.ServeContext(ctx)
+	<-started
+
+	removed := make(chan bool)
+	go func() { removed <- m.Remove("1:token") }()
+	select {
+	case ok := <-removed:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("Remove waits for the bot which is not running yet")
+	}
+	assert.Empty(t, failed, "the removed bot has not failed")
+}
@@ -36,26 +36,32 @@ func jsonPayload(obj APIMethod, body io.Writer) (string, error) {
 
 // methodWithNoParams is used to send a request that requires no parameters,
 // meaning there is no request body and it does not require Content-Type header.
-type methodWithNoParams string
+// T is the type of its result.
+type methodWithNoParams[T any] string
 
-func (m methodWithNoParams) APIEndpoint() string {
+func (m methodWithNoParams[T]) APIEndpoint() string {
 	return string(m)
 }
 
-func (m methodWithNoParams) WritePayload(_ io.Writer) (string, error) {
+func (m methodWithNoParams[T]) WritePayload(_ io.Writer) (string, error) {
 	return "", nil
 }
 
+func (m methodWithNoParams[T]) ResultType() T {
+	var zero T
+	return zero
+}
+
 const (
 	// Getting updates
 
-	GetWebhookInfo methodWithNoParams = "getWebhookInfo"
+	GetWebhookInfo methodWithNoParams[WebhookInfo] = "getWebhookInfo"
 
 	// Available methods
 
-	GetMe  methodWithNoParams = "getMe"
-	LogOut methodWithNoParams = "logOut"
-	Close  methodWithNoParams = "close"
+	GetMe  methodWithNoParams[User] = "getMe"
+	LogOut methodWithNoParams[bool] = "logOut"
+	Close  methodWithNoParams[bool] = "close"
 )
 
 /*
@@ -73,6 +79,10 @@ func (m GetUpdates) APIEndpoint() string {
 	return "getUpdates"
 }
 
+func (m GetUpdates) ResultType() []Update {
+	return nil
+}
+
 func (m GetUpdates) WritePayload(body io.Writer) (string, error) {
 	return jsonPayload(&m, body)
 }
@@ -80,17 +90,21 @@ func (m GetUpdates) WritePayload(body io.Writer) (string, error) {
 type SetWebhook struct {
 	URL                string    `validate:"url" json:"url"`
 	Certificate        InputFile `json:"certificate,omitempty"`
-	IPAddress          string    `validate:"ip" json:"ip_address,omitempty"`
-	MaxConnections     int       `validate:"min=1,max=100" json:"max_connections,omitempty"`
+	IPAddress          string    `validate:"omitempty,ip" json:"ip_address,omitempty"`
+	MaxConnections     int       `validate:"omitempty,min=1,max=100" json:"max_connections,omitempty"`
 	AllowedUpdates     []string  `json:"allowed_updates,omitempty"`
 	DropPendingUpdates bool      `json:"drop_pending_updates,omitempty"`
-	SecretToken        string    `validate:"min=1,max=100,regexp=^[a-zA-Z0-9_-]+$" json:"secret_token,omitempty"`
+	SecretToken        string    `validate:"omitempty,max=256,secret_token" json:"secret_token,omitempty"`
 }
 
 func (m SetWebhook) APIEndpoint() string {
 	return "setWebhook"
 }
 
+func (m SetWebhook) ResultType() bool {
+	return false
+}
+
 func (m SetWebhook) WritePayload(body io.Writer) (string, error) {
 	if _, ok := m.Certificate.(InputFileRemote); ok {
 		return "", fmt.Errorf("can't upload a certificate from a remote source; use a local file")
@@ -125,6 +139,10 @@ func (m DeleteWebhook) APIEndpoint() string {
 	return "deleteWebhook"
 }
 
+func (m DeleteWebhook) ResultType() bool {
+	return false
+}
+
 func (m DeleteWebhook) WritePayload(w io.Writer) (string, error) {
 	return jsonPayload(&m, w)
 }
@@ -152,6 +170,10 @@ func (m SendMessage) APIEndpoint() string {
 	return "sendMessage"
 }
 
+func (m SendMessage) ResultType() Message {
+	return Message{}
+}
+
 func (m SendMessage) WritePayload(body io.Writer) (string, error) {
 	return jsonPayload(&m, body)
 }
@@ -170,6 +192,10 @@ func (m ForwardMessage) APIEndpoint() string {
 	return "forwardMessage"
 }
 
+func (m ForwardMessage) ResultType() Message {
+	return Message{}
+}
+
 func (m ForwardMessage) WritePayload(w io.Writer) (string, error) {
 	return jsonPayload(&m, w)
 }
@@ -187,6 +213,10 @@ func (m ForwardMessages) APIEndpoint() string {
 	return "forwardMessages"
 }
 
+func (m ForwardMessages) ResultType() []MessageId {
+	return nil
+}
+
 func (m ForwardMessages) WritePayload(w io.Writer) (string, error) {
 	return jsonPayload(&m, w)
 }
@@ -212,6 +242,10 @@ func (m CopyMessage) APIEndpoint() string {
 	return "copyMessage"
 }
 
+func (m CopyMessage) ResultType() MessageId {
+	return MessageId{}
+}
+
 func (m CopyMessage) WritePayload(w io.Writer) (string, error) {
 	return jsonPayload(&m, w)
 }
@@ -231,6 +265,10 @@ func (m CopyMessages) APIEndpoint() string {
 	return "copyMessages"
 }
 
+func (m CopyMessages) ResultType() []MessageId {
+	return nil
+}
+
 func (m CopyMessages) WritePayload(w io.Writer) (string, error) {
 	return jsonPayload(&m, w)
 }
@@ -257,6 +295,10 @@ func (m SendPhoto) APIEndpoint() string {
 	return "sendPhoto"
 }
 
+func (m SendPhoto) ResultType() Message {
+	return Message{}
+}
+
 func (m SendPhoto) WritePayload(body io.Writer) (string, error) {
 	if _, ok := m.Photo.(InputFileRemote); ok {
 		return jsonPayload(&m, body)
@@ -269,7 +311,7 @@ func (m SendPhoto) WritePayload(body io.Writer) (string, error) {
 		WriteStringCond("business_connection_id", m.BusinessConnectionID, notEmptyString(m.BusinessConnectionID)).
 		WriteIntCond("message_thread_id", m.MessageThreadID, notEmptyInt(m.MessageThreadID)).
 		WriteStringCond("caption", m.Caption, notEmptyString(m.Caption)).
-		WriteJSONCond("message_entities", m.CaptionEntities, notEmptySlice(*m.CaptionEntities)).
+		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlicePtr(m.CaptionEntities)).
 		WriteBoolCond("show_caption_above_media", m.ShowCaptionAboveMedia, func() bool { return m.ShowCaptionAboveMedia }).
 		WriteBoolCond("has_spoiler", m.HasSpoiler, func() bool { return m.HasSpoiler }).
 		WriteBoolCond("disable_notification", m.DisableNotification, func() bool { return m.DisableNotification }).
@@ -315,7 +357,7 @@ func (m SendAudio) WritePayload(body io.Writer) (string, error) {
 		WriteIntCond("message_thread_id", m.MessageThreadID, notEmptyInt(m.MessageThreadID)).
 		WriteStringCond("caption", m.Caption, notEmptyString(m.Caption)).
 		WriteStringCond("parse_mode", m.ParseMode, notEmptyString(m.ParseMode)).
-		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlice(*m.CaptionEntities)).
+		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlicePtr(m.CaptionEntities)).
 		WriteIntCond("duration", m.Duration, notEmptyInt(m.Duration)).
 		WriteStringCond("performer", m.Performer, notEmptyString(m.Performer)).
 		WriteStringCond("title", m.Title, notEmptyString(m.Title)).
@@ -345,6 +387,10 @@ func (m SendAudio) APIEndpoint() string {
 	return "sendAudio"
 }
 
+func (m SendAudio) ResultType() Message {
+	return Message{}
+}
+
 type SendDocument struct {
 	ChatID                      string           `validate:"required" json:"chat_id"`
 	Document                    InputFile        `validate:"required" json:"document"`
@@ -367,6 +413,10 @@ func (m SendDocument) APIEndpoint() string {
 	return "sendDocument"
 }
 
+func (m SendDocument) ResultType() Message {
+	return Message{}
+}
+
 func (m SendDocument) WritePayload(body io.Writer) (string, error) {
 	doc, ok1 := m.Document.(InputFileLocal)
 	thumbnail, ok2 := m.Thumbnail.(InputFileLocal)
@@ -381,7 +431,7 @@ func (m SendDocument) WritePayload(body io.Writer) (string, error) {
 		WriteIntCond("message_thread_id", m.MessageThreadID, notEmptyInt(m.MessageThreadID)).
 		WriteStringCond("caption", m.Caption, notEmptyString(m.Caption)).
 		WriteStringCond("parse_mode", m.ParseMode, notEmptyString(m.ParseMode)).
-		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlice(*m.CaptionEntities)).
+		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlicePtr(m.CaptionEntities)).
 		WriteBoolCond("disable_content_type_detection", m.DisableContentTypeDetection, func() bool { return m.DisableContentTypeDetection }).
 		WriteBoolCond("disable_notification", m.DisableNotification, func() bool { return m.DisableNotification }).
 		WriteBoolCond("protect_content", m.ProtectContent, func() bool { return m.ProtectContent }).
@@ -434,6 +484,10 @@ func (m SendVideo) APIEndpoint() string {
 	return "sendVideo"
 }
 
+func (m SendVideo) ResultType() Message {
+	return Message{}
+}
+
 func (m SendVideo) WritePayload(body io.Writer) (string, error) {
 	video, ok1 := m.Video.(InputFileLocal)
 	thumbnail, ok2 := m.Thumbnail.(InputFileLocal)
@@ -453,7 +507,7 @@ func (m SendVideo) WritePayload(body io.Writer) (string, error) {
 		WriteIntCond("start_timestamp", m.StartTimestamp, notEmptyInt(m.StartTimestamp)).
 		WriteStringCond("caption", m.Caption, notEmptyString(m.Caption)).
 		WriteStringCond("parse_mode", m.ParseMode, notEmptyString(m.ParseMode)).
-		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlice(*m.CaptionEntities)).
+		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlicePtr(m.CaptionEntities)).
 		WriteBoolCond("show_caption_above_media", m.ShowCaptionAboveMedia, func() bool { return m.ShowCaptionAboveMedia }).
 		WriteBoolCond("has_spoiler", m.HasSpoiler, func() bool { return m.HasSpoiler }).
 		WriteBoolCond("supports_streaming", m.SupportsStreaming, func() bool { return m.SupportsStreaming }).
@@ -512,6 +566,10 @@ func (m SendAnimation) APIEndpoint() string {
 	return "sendAnimation"
 }
 
+func (m SendAnimation) ResultType() Message {
+	return Message{}
+}
+
 func (m SendAnimation) WritePayload(body io.Writer) (string, error) {
 	animation, ok1 := m.Animation.(InputFileLocal)
 	thumbnail, ok2 := m.Thumbnail.(InputFileLocal)
@@ -529,7 +587,7 @@ func (m SendAnimation) WritePayload(body io.Writer) (string, error) {
 		WriteIntCond("height", m.Height, notEmptyInt(m.Height)).
 		WriteStringCond("caption", m.Caption, notEmptyString(m.Caption)).
 		WriteStringCond("parse_mode", m.ParseMode, notEmptyString(m.ParseMode)).
-		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlice(*m.CaptionEntities)).
+		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlicePtr(m.CaptionEntities)).
 		WriteBoolCond("show_caption_above_media", m.ShowCaptionAboveMedia, func() bool { return m.ShowCaptionAboveMedia }).
 		WriteBoolCond("has_spoiler", m.HasSpoiler, func() bool { return m.HasSpoiler }).
 		WriteBoolCond("disable_notification", m.DisableNotification, func() bool { return m.DisableNotification }).
@@ -576,6 +634,10 @@ func (m SendVoice) APIEndpoint() string {
 	return "sendVoice"
 }
 
+func (m SendVoice) ResultType() Message {
+	return Message{}
+}
+
 func (m SendVoice) WritePayload(body io.Writer) (string, error) {
 	voice, ok1 := m.Voice.(InputFileLocal)
 	if !ok1 {
@@ -589,7 +651,7 @@ func (m SendVoice) WritePayload(body io.Writer) (string, error) {
 		WriteIntCond("message_thread_id", m.MessageThreadID, notEmptyInt(m.MessageThreadID)).
 		WriteStringCond("caption", m.Caption, notEmptyString(m.Caption)).
 		WriteStringCond("parse_mode", m.ParseMode, notEmptyString(m.ParseMode)).
-		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlice(*m.CaptionEntities)).
+		WriteJSONCond("caption_entities", m.CaptionEntities, notEmptySlicePtr(m.CaptionEntities)).
 		WriteIntCond("duration", m.Duration, notEmptyInt(m.Duration)).
 		WriteBoolCond("disable_notification", m.DisableNotification, func() bool { return m.DisableNotification }).
 		WriteBoolCond("protect_content", m.ProtectContent, func() bool { return m.ProtectContent }).
@@ -621,6 +683,10 @@ func (m SendVideoNote) APIEndpoint() string {
 	return "sendVideoNote"
 }
 
+func (m SendVideoNote) ResultType() Message {
+	return Message{}
+}
+
 func (m SendVideoNote) WritePayload(body io.Writer) (string, error) {
 	note, ok1 := m.VideoNote.(InputFileLocal)
 	thumbnail, ok2 := m.Thumbnail.(InputFileLocal)
@@ -658,6 +724,84 @@ func (m SendVideoNote) WritePayload(body io.Writer) (string, error) {
 	return mw.FormDataContentType(), mw.Close()
 }
 
+type EditMessageText struct {
+	BusinessConnectionID string                `json:"business_connection_id,omitempty"`
+	ChatID               string                `json:"chat_id,omitempty"`
+	MessageID            int                   `json:"message_id,omitempty"`
+	InlineMessageID      string                `json:"inline_message_id,omitempty"`
+	Text                 string                `validate:"required,min=1,max=4096" json:"text"`
+	ParseMode            string                `json:"parse_mode,omitempty"`
+	Entities             *[]MessageEntity      `json:"entities,omitempty"`
+	LinkPreviewOptions   *LinkPreviewOptions   `json:"link_preview_options,omitempty"`
+	ReplyMarkup          *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+func (m EditMessageText) APIEndpoint() string {
+	return "editMessageText"
+}
+
+func (m EditMessageText) ResultType() EditedMessage {
+	return EditedMessage{}
+}
+
+func (m EditMessageText) WritePayload(body io.Writer) (string, error) {
+	return jsonPayload(&m, body)
+}
+
+type DeleteMessage struct {
+	ChatID    string `validate:"required" json:"chat_id"`
+	MessageID int    `validate:"required" json:"message_id"`
+}
+
+func (m DeleteMessage) APIEndpoint() string {
+	return "deleteMessage"
+}
+
+func (m DeleteMessage) ResultType() bool {
+	return false
+}
+
+func (m DeleteMessage) WritePayload(body io.Writer) (string, error) {
+	return jsonPayload(&m, body)
+}
+
+type GetChatMember struct {
+	ChatID string `validate:"required" json:"chat_id"`
+	UserID int    `validate:"required" json:"user_id"`
+}
+
+func (m GetChatMember) APIEndpoint() string {
+	return "getChatMember"
+}
+
+func (m GetChatMember) ResultType() ChatMember {
+	return ChatMember{}
+}
+
+func (m GetChatMember) WritePayload(body io.Writer) (string, error) {
+	return jsonPayload(&m, body)
+}
+
+type AnswerCallbackQuery struct {
+	CallbackQueryID string `validate:"required" json:"callback_query_id"`
+	Text            string `validate:"max=200" json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+	URL             string `json:"url,omitempty"`
+	CacheTime       int    `json:"cache_time,omitempty"`
+}
+
+func (m AnswerCallbackQuery) APIEndpoint() string {
+	return "answerCallbackQuery"
+}
+
+func (m AnswerCallbackQuery) ResultType() bool {
+	return false
+}
+
+func (m AnswerCallbackQuery) WritePayload(body io.Writer) (string, error) {
+	return jsonPayload(&m, body)
+}
+
 type GetMyCommands struct {
 	Scope        BotCommandScope `json:"scope,omitempty"`
 	LanguageCode string          `json:"language_code,omitempty"`
@@ -667,6 +811,10 @@ func (m GetMyCommands) APIEndpoint() string {
 	return "getMyCommands"
 }
 
+func (m GetMyCommands) ResultType() []BotCommand {
+	return nil
+}
+
 func (m GetMyCommands) WritePayload(body io.Writer) (string, error) {
 	return jsonPayload(&m, body)
 }
@@ -681,6 +829,10 @@ func (m SetMyCommands) APIEndpoint() string {
 	return "setMyCommands"
 }
 
+func (m SetMyCommands) ResultType() bool {
+	return false
+}
+
 func (m SetMyCommands) WritePayload(body io.Writer) (string, error) {
 	return jsonPayload(&m, body)
 }
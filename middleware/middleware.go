@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/bigelle/botify"
+	"github.com/go-logr/logr"
 )
 
+var _ botify.Middleware = RecoveryMiddleware
+
 // RecoveryMiddleware is a middleware that wraps next [botify.HandlerFunc] with a built-in Go recovery function.
+// Errors returned by next are passed through untouched.
 func RecoveryMiddleware(next botify.HandlerFunc) botify.HandlerFunc {
 	return func(ctx *botify.Context) error {
 		defer func() {
@@ -14,7 +20,23 @@ func RecoveryMiddleware(next botify.HandlerFunc) botify.HandlerFunc {
 				ctx.Bot().Logger.Error(fmt.Errorf("%+v", r), "PANIC in handler for update", "type", ctx.UpdateType(), "ID", ctx.UpdateID())
 			}
 		}()
-		next(ctx)
-		return nil
+		return next(ctx)
+	}
+}
+
+// LogRequests returns a [botify.SenderMiddleware] which logs every outgoing request,
+// how long it took and the error, if any.
+func LogRequests(logger logr.Logger) botify.SenderMiddleware {
+	return func(next botify.SendFunc) botify.SendFunc {
+		return func(ctx context.Context, method string, obj any) (*botify.APIResponse, error) {
+			start := time.Now()
+			resp, err := next(ctx, method, obj)
+			if err != nil {
+				logger.Error(err, "request failed", "method", method, "took", time.Since(start))
+			} else {
+				logger.V(1).Info("request sent", "method", method, "took", time.Since(start))
+			}
+			return resp, err
+		}
 	}
 }
@@ -0,0 +1,144 @@
+package botify
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ChatMigration returns a [SenderMiddleware] which handles the groups upgraded to supergroups.
+// Once the request fails with [ChatMigratedError], it's sent again to the new chat,
+// and every following request to the old chat is sent to the new one right away.
+// onMigrated, if not nil, is called once for every migrated chat,
+// e.g. to replace the chat ID in the database.
+//
+// Only the requests with the chat ID, taken from the ChatID field of the [APIMethod]
+// or from the "chat_id" field of the object sent with SendJSON, can be sent again.
+// The files uploaded from [io.Reader] are read only once, so such requests are not sent again:
+// the error is returned, but the following requests still go to the new chat.
+// See also [Bot.OnChatMigrated].
+func ChatMigration(onMigrated func(oldID, newID int64)) SenderMiddleware {
+	return (&chatMigrations{onMigrated: onMigrated}).middleware
+}
+
+// chatMigrations remembers the migrated chats
+type chatMigrations struct {
+	onMigrated func(oldID, newID int64)
+
+	mu sync.Mutex
+	m  map[int64]int64
+}
+
+// migrate remembers the new ID of the chat and calls onMigrated, if it's not known yet
+func (c *chatMigrations) migrate(oldID, newID int64) {
+	c.mu.Lock()
+	if c.m == nil {
+		c.m = make(map[int64]int64)
+	}
+	known := c.m[oldID] == newID
+	c.m[oldID] = newID
+	c.mu.Unlock()
+
+	if !known && c.onMigrated != nil {
+		c.onMigrated(oldID, newID)
+	}
+}
+
+func (c *chatMigrations) lookup(oldID int64) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	newID, ok := c.m[oldID]
+	return newID, ok
+}
+
+func (c *chatMigrations) middleware(next SendFunc) SendFunc {
+	return func(ctx context.Context, method string, obj any) (*APIResponse, error) {
+		chatID, ok := requestChatID(obj)
+		if !ok {
+			return next(ctx, method, obj)
+		}
+		if newID, migrated := c.lookup(chatID); migrated {
+			if moved, ok := withChatID(obj, newID); ok {
+				obj, chatID = moved, newID
+			}
+		}
+
+		resp, err := next(ctx, method, obj)
+
+		var errMigrated ChatMigratedError
+		if !errors.As(err, &errMigrated) {
+			return resp, err
+		}
+		newID := int64(errMigrated.NewChatID())
+		c.migrate(chatID, newID)
+
+		if carriesReader(reflect.ValueOf(obj), 0) {
+			// the file has already been read
+			return resp, err
+		}
+		moved, ok := withChatID(obj, newID)
+		if !ok {
+			return resp, err
+		}
+		return next(ctx, method, moved)
+	}
+}
+
+// requestChatID returns the numeric chat ID of the request, see [messageChat]
+func requestChatID(obj any) (int64, bool) {
+	chat, _, ok := messageChat(obj)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(chat, 10, 64)
+	return id, err == nil
+}
+
+// withChatID returns the copy of the request with the chat ID replaced,
+// the request itself is left untouched
+func withChatID(obj any, chatID int64) (any, bool) {
+	switch m := obj.(type) {
+	case JSON:
+		return withJSONChatID(m, chatID), true
+	case map[string]any:
+		return map[string]any(withJSONChatID(m, chatID)), true
+	}
+
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	cp := reflect.New(v.Type())
+	cp.Elem().Set(v)
+	f := cp.Elem().FieldByName("ChatID")
+	switch {
+	case !f.IsValid() || !f.CanSet():
+		return nil, false
+	case f.Kind() == reflect.String:
+		f.SetString(strconv.FormatInt(chatID, 10))
+	case f.CanInt():
+		f.SetInt(chatID)
+	default:
+		return nil, false
+	}
+	return cp.Interface(), true
+}
+
+func withJSONChatID(m JSON, chatID int64) JSON {
+	cp := make(JSON, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	cp["chat_id"] = chatID
+	return cp
+}
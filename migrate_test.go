@@ -0,0 +1,111 @@
+package botify
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatMigration(t *testing.T) {
+	newID := -100123
+	sender := &scriptedSender{script: []scriptedResponse{
+		{Resp: &APIResponse{
+			Ok:          false,
+			ErrorCode:   400,
+			Description: "Bad Request: group chat was upgraded to a supergroup chat",
+			Parameters:  &ResponseParameters{MigrateToChatID: &newID},
+		}},
+	}}
+
+	var migrated [][2]int64
+	s := WrapSender(sender, ChatMigration(func(oldID, newID int64) {
+		migrated = append(migrated, [2]int64{oldID, newID})
+	}))
+
+	msg := &SendMessage{ChatID: "-1", Text: "hi"}
+	_, err := s.Send(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "-1", msg.ChatID, "the request itself is left untouched")
+
+	// the following requests go to the new chat right away
+	_, err = s.Send(&SendMessage{ChatID: "-1", Text: "hi again"})
+	assert.NoError(t, err)
+	_, err = s.Send(&SendMessage{ChatID: "-2", Text: "hi"})
+	assert.NoError(t, err)
+
+	var chats []string
+	for _, sent := range sender.Sent() {
+		chats = append(chats, sent.(*SendMessage).ChatID)
+	}
+	assert.Equal(t, []string{"-1", "-100123", "-100123", "-2"}, chats)
+	assert.Equal(t, [][2]int64{{-1, -100123}}, migrated)
+}
+
+func TestChatMigration_Upload(t *testing.T) {
+	newID := -100123
+	sender := &scriptedSender{script: []scriptedResponse{
+		{Resp: &APIResponse{
+			Ok:          false,
+			ErrorCode:   400,
+			Description: "Bad Request: group chat was upgraded to a supergroup chat",
+			Parameters:  &ResponseParameters{MigrateToChatID: &newID},
+		}},
+	}}
+
+	var migrated [][2]int64
+	s := WrapSender(sender, ChatMigration(func(oldID, newID int64) {
+		migrated = append(migrated, [2]int64{oldID, newID})
+	}))
+
+	_, err := s.Send(&SendPhoto{ChatID: "-1", Photo: InputFileLocal{Name: "photo.jpg", Data: strings.NewReader("photo")}})
+	var errMigrated ChatMigratedError
+	assert.ErrorAs(t, err, &errMigrated, "the file has already been read, so it can't be sent again")
+	assert.Len(t, sender.Sent(), 1)
+	assert.Equal(t, [][2]int64{{-1, -100123}}, migrated)
+
+	// the following uploads go to the new chat right away
+	_, err = s.Send(&SendPhoto{ChatID: "-1", Photo: InputFileLocal{Name: "photo.jpg", Data: strings.NewReader("photo")}})
+	assert.NoError(t, err)
+	if sent, ok := sender.Sent()[1].(*SendPhoto); assert.True(t, ok) {
+		assert.Equal(t, "-100123", sent.ChatID)
+	}
+}
+
+func TestWithChatID(t *testing.T) {
+	obj := JSON{"chat_id": -1, "text": "hi"}
+	moved, ok := withChatID(obj, -100)
+	assert.True(t, ok)
+	assert.Equal(t, JSON{"chat_id": int64(-100), "text": "hi"}, moved)
+	assert.Equal(t, -1, obj["chat_id"])
+
+	moved, ok = withChatID(SendMessage{ChatID: "-1"}, -100)
+	assert.True(t, ok)
+	assert.Equal(t, &SendMessage{ChatID: "-100"}, moved)
+
+	_, ok = withChatID(&GetUpdates{}, -100)
+	assert.False(t, ok)
+}
+
+func TestBot_OnChatMigrated(t *testing.T) {
+	var migrated [][2]int64
+	b := &Bot{
+		Token:    "1:token",
+		Sender:   &testSender{},
+		Receiver: &testReceiver{},
+		Logger:   logr.Discard(),
+		OnChatMigrated: func(oldID, newID int64) {
+			migrated = append(migrated, [2]int64{oldID, newID})
+		},
+	}
+	b.init(context.Background())
+
+	newID := int64(-100123)
+	upd := Update{Message: &Message{Chat: Chat{ID: -1}, MigrateToChatId: &newID}}
+	b.handleUpdate(&upd, nil)
+	b.handleUpdate(&upd, nil)
+
+	assert.Equal(t, [][2]int64{{-1, -100123}}, migrated, "called once for every chat")
+}
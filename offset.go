@@ -0,0 +1,89 @@
+package botify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bigelle/botify/internal/jsonfile"
+)
+
+// OffsetStore keeps the offset of the first update to be received by [LongPolling],
+// so the bot continues from where it has stopped after the restart.
+// Implementations must be safe for concurrent use.
+type OffsetStore interface {
+	// LoadOffset returns the saved offset, or zero without any error if there's none.
+	LoadOffset(ctx context.Context) (int, error)
+	// SaveOffset replaces the saved offset.
+	SaveOffset(ctx context.Context, offset int) error
+}
+
+// MemoryOffsetStore is an in-memory implementation of [OffsetStore].
+// The offset is lost when the program exits.
+// It is ready to use with its zero value.
+type MemoryOffsetStore struct {
+	mu     sync.Mutex
+	offset int
+}
+
+// LoadOffset satisfies the OffsetStore interface
+func (s *MemoryOffsetStore) LoadOffset(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offset, nil
+}
+
+// SaveOffset satisfies the OffsetStore interface
+func (s *MemoryOffsetStore) SaveOffset(_ context.Context, offset int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset = offset
+	return nil
+}
+
+// FileOffsetStore is an implementation of [OffsetStore],
+// which saves the offset into the local JSON file, so it survives restarts.
+// It is not meant to be shared between several running programs.
+type FileOffsetStore struct {
+	// Path to the file. It will be created if it doesn't exist.
+	Path string
+
+	mu sync.Mutex
+}
+
+type offsetFile struct {
+	Offset int `json:"offset"`
+}
+
+// LoadOffset satisfies the OffsetStore interface
+func (s *FileOffsetStore) LoadOffset(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Path == "" {
+		return 0, fmt.Errorf("offset store file path is empty")
+	}
+
+	var f offsetFile
+	if err := jsonfile.Read(s.Path, &f); err != nil {
+		return 0, fmt.Errorf("loading offset: %w", err)
+	}
+	return f.Offset, nil
+}
+
+// SaveOffset satisfies the OffsetStore interface
+func (s *FileOffsetStore) SaveOffset(_ context.Context, offset int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Path == "" {
+		return fmt.Errorf("offset store file path is empty")
+	}
+
+	if err := jsonfile.Write(s.Path, offsetFile{Offset: offset}); err != nil {
+		return fmt.Errorf("saving offset: %w", err)
+	}
+	return nil
+}
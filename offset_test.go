@@ -0,0 +1,26 @@
+package botify
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileOffsetStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offset.json")
+
+	s := &FileOffsetStore{Path: path}
+	offset, err := s.LoadOffset(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, offset)
+
+	assert.NoError(t, s.SaveOffset(context.Background(), 42))
+
+	// reading from the same file as if the program was restarted
+	s = &FileOffsetStore{Path: path}
+	offset, err = s.LoadOffset(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 42, offset)
+}
@@ -0,0 +1,279 @@
+package botify
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Requests requests per the given period of time.
+// The requests may be sent in a burst, as long as the limit is not exceeded.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l RateLimit) isZero() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// RateLimitedSender is a [RequestSender] which delays the requests sending messages,
+// so they don't exceed the flood limits of Telegram and don't cause [TooManyRequestsError].
+// Only the requests whose endpoint starts with "send", "forward" or "copy" and which have a chat ID are limited,
+// others are sent right away.
+// The chat ID is taken from the ChatID field of the [APIMethod],
+// or from the "chat_id" field of the object sent with SendJSON.
+//
+// The waiting is cut short once the context of the request is done, in that case the request is not sent.
+// It is ready to use with its zero value once the Sender is set.
+type RateLimitedSender struct {
+	// Sends the requests once they're allowed.
+	// Required
+	Sender RequestSender
+	// The limit for every message sent by the bot.
+	// Defaults to 30 messages per second
+	Global RateLimit
+	// The limit for the messages sent to the same private chat.
+	// Defaults to 1 message per second
+	PrivateChat RateLimit
+	// The limit for the messages sent to the same group or channel.
+	// Defaults to 20 messages per minute
+	GroupChat RateLimit
+	// Used instead of Global for the messages with AllowPaidBroadcast set.
+	// Defaults to 1000 messages per second
+	PaidBroadcast RateLimit
+
+	mu        sync.Mutex
+	global    *tokenBucket
+	paid      *tokenBucket
+	chats     map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// Send satisfies RequestSender interface.
+// It's a wrapper for [SendWithContext] that uses [context.Background] as ctx.
+func (s *RateLimitedSender) Send(obj APIMethod) (*APIResponse, error) {
+	return s.SendWithContext(context.Background(), obj)
+}
+
+// SendWithContext satisfies RequestSender interface.
+// It waits until the request is allowed, or until ctx is done
+func (s *RateLimitedSender) SendWithContext(ctx context.Context, obj APIMethod) (*APIResponse, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("obj can't be empty")
+	}
+	if err := s.wait(ctx, obj.APIEndpoint(), obj); err != nil {
+		return nil, err
+	}
+	return s.Sender.SendWithContext(ctx, obj)
+}
+
+// SendJSON satisfies RequestSender interface.
+// It's a wrapper for [SendJSONWithContext] that uses [context.Background] as ctx.
+func (s *RateLimitedSender) SendJSON(method string, obj any) (*APIResponse, error) {
+	return s.SendJSONWithContext(context.Background(), method, obj)
+}
+
+// SendJSONWithContext satisfies RequestSender interface.
+// It waits until the request is allowed, or until ctx is done
+func (s *RateLimitedSender) SendJSONWithContext(ctx context.Context, method string, obj any) (*APIResponse, error) {
+	if err := s.wait(ctx, method, obj); err != nil {
+		return nil, err
+	}
+	return s.Sender.SendJSONWithContext(ctx, method, obj)
+}
+
+// wait blocks until the request can be sent without exceeding the limits
+func (s *RateLimitedSender) wait(ctx context.Context, method string, obj any) error {
+	if s.Sender == nil {
+		return fmt.Errorf("rate limited sender has no sender to send requests with")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !isMessageMethod(method) {
+		return nil
+	}
+	chatID, paid, ok := messageChat(obj)
+	if !ok {
+		return nil
+	}
+
+	global, chat := s.buckets(chatID, paid)
+
+	now := time.Now()
+	delay := max(global.reserve(now), chat.reserve(now))
+	if delay <= 0 {
+		return nil
+	}
+	if !sleepContext(ctx, delay) {
+		// the request is not sent, so it's not counted
+		global.release()
+		chat.release()
+		return fmt.Errorf("waiting for rate limit: %w", ctx.Err())
+	}
+	return nil
+}
+
+// how often the idle chat buckets are evicted
+const rateLimitSweepInterval = time.Minute
+
+func (s *RateLimitedSender) buckets(chatID string, paid bool) (global, chat *tokenBucket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.global == nil {
+		s.global = newTokenBucket(orDefaultLimit(s.Global, RateLimit{30, time.Second}))
+		s.paid = newTokenBucket(orDefaultLimit(s.PaidBroadcast, RateLimit{1000, time.Second}))
+		s.chats = make(map[string]*tokenBucket)
+	}
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		s.lastSweep = now
+		for id, b := range s.chats {
+			if b.isIdle(now) {
+				delete(s.chats, id)
+			}
+		}
+	}
+
+	chat, ok := s.chats[chatID]
+	if !ok {
+		limit := orDefaultLimit(s.GroupChat, RateLimit{20, time.Minute})
+		if isPrivateChat(chatID) {
+			limit = orDefaultLimit(s.PrivateChat, RateLimit{1, time.Second})
+		}
+		chat = newTokenBucket(limit)
+		s.chats[chatID] = chat
+	}
+
+	if paid {
+		return s.paid, chat
+	}
+	return s.global, chat
+}
+
+func orDefaultLimit(l, def RateLimit) RateLimit {
+	if l.isZero() {
+		return def
+	}
+	return l
+}
+
+func isMessageMethod(method string) bool {
+	return strings.HasPrefix(method, "send") || strings.HasPrefix(method, "forward") || strings.HasPrefix(method, "copy")
+}
+
+// isPrivateChat reports if the chat ID belongs to a user: those are positive,
+// while the IDs of groups and channels are negative, and their usernames start with @
+func isPrivateChat(chatID string) bool {
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	return err == nil && id > 0
+}
+
+// messageChat returns the chat ID of the request and whether it's a paid broadcast.
+// It understands the structs with ChatID and AllowPaidBroadcast fields, and the maps like [JSON]
+func messageChat(obj any) (chatID string, paid bool, ok bool) {
+	if m, isMap := obj.(map[string]any); isMap {
+		obj = JSON(m)
+	}
+	if m, isMap := obj.(JSON); isMap {
+		paid, _ = m["allow_paid_broadcast"].(bool)
+		switch id := m["chat_id"].(type) {
+		case string:
+			return id, paid, id != ""
+		case int:
+			return strconv.Itoa(id), paid, true
+		case int64:
+			return strconv.FormatInt(id, 10), paid, true
+		case float64:
+			return strconv.FormatInt(int64(id), 10), paid, true
+		}
+		return "", false, false
+	}
+
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", false, false
+	}
+
+	if f := v.FieldByName("AllowPaidBroadcast"); f.IsValid() && f.Kind() == reflect.Bool {
+		paid = f.Bool()
+	}
+	f := v.FieldByName("ChatID")
+	switch {
+	case !f.IsValid():
+		return "", false, false
+	case f.Kind() == reflect.String:
+		return f.String(), paid, f.String() != ""
+	case f.CanInt():
+		return strconv.FormatInt(f.Int(), 10), paid, true
+	}
+	return "", false, false
+}
+
+// tokenBucket allows limit.Requests requests per limit.Per, refilling gradually
+type tokenBucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Requests), last: time.Now()}
+}
+
+// interval returns the time it takes to refill a single token
+func (b *tokenBucket) interval() time.Duration {
+	return b.limit.Per / time.Duration(b.limit.Requests)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.limit.Requests), b.tokens+float64(elapsed)/float64(b.interval()))
+		b.last = now
+	}
+}
+
+// reserve takes a token, going into debt if there's none,
+// and returns how long to wait before the token is actually available
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval()))
+}
+
+// release gives back the reserved token
+func (b *tokenBucket) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(float64(b.limit.Requests), b.tokens+1)
+}
+
+// isIdle reports if the bucket is full, so it's no different from a new one
+func (b *tokenBucket) isIdle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= float64(b.limit.Requests)
+}
@@ -0,0 +1,83 @@
+package botify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageChat(t *testing.T) {
+	tests := []struct {
+		name     string
+		obj      any
+		wantChat string
+		wantPaid bool
+		wantOk   bool
+	}{
+		{name: "method", obj: &SendMessage{ChatID: "1", Text: "hi"}, wantChat: "1", wantOk: true},
+		{name: "method by value", obj: SendMessage{ChatID: "@channel"}, wantChat: "@channel", wantOk: true},
+		{name: "paid broadcast", obj: &SendMessage{ChatID: "1", AllowPaidBroadcast: true}, wantChat: "1", wantPaid: true, wantOk: true},
+		{name: "json", obj: JSON{"chat_id": -100, "allow_paid_broadcast": true}, wantChat: "-100", wantPaid: true, wantOk: true},
+		{name: "decoded json", obj: map[string]any{"chat_id": float64(42)}, wantChat: "42", wantOk: true},
+		{name: "no chat", obj: &GetUpdates{}},
+		{name: "empty chat", obj: &SendMessage{}},
+		{name: "nil", obj: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat, paid, ok := messageChat(tt.obj)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantChat, chat)
+			assert.Equal(t, tt.wantPaid, paid)
+		})
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{Requests: 2, Per: time.Second})
+	now := b.last
+
+	assert.Zero(t, b.reserve(now))
+	assert.Zero(t, b.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now))
+	assert.Equal(t, time.Second, b.reserve(now))
+
+	b.release()
+	assert.Equal(t, time.Second, b.reserve(now))
+	assert.False(t, b.isIdle(now))
+
+	// every debt is paid off and the bucket is refilled
+	assert.True(t, b.isIdle(now.Add(3*time.Second)))
+}
+
+func TestRateLimitedSender(t *testing.T) {
+	sender := &testSender{}
+	s := &RateLimitedSender{
+		Sender:      sender,
+		PrivateChat: RateLimit{Requests: 1, Per: 50 * time.Millisecond},
+	}
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 3 {
+		_, err := s.SendWithContext(ctx, &SendMessage{ChatID: "1", Text: "hi"})
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	start = time.Now()
+	_, err := s.SendWithContext(ctx, &SendMessage{ChatID: "2", Text: "hi"})
+	assert.NoError(t, err)
+	_, err = s.SendWithContext(ctx, &GetUpdates{})
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "other chats and methods are not delayed")
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.SendWithContext(ctx, &SendMessage{ChatID: "2", Text: "hi"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, sender.Sent(), 5)
+}
@@ -1,13 +1,20 @@
 package botify
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bigelle/botify/internal/reused"
@@ -21,15 +28,64 @@ type UpdateReceiver interface {
 	PairBot(*Bot)
 }
 
+// UpdateAcknowledger is implemented by the receivers which need to know when the update is handled,
+// e.g. to confirm it only after that. See [LongPolling.CommitOnHandled].
+// The bot calls AckUpdate for every received update once it's handled, no matter if successfully,
+// or if there was no handler for it at all.
+type UpdateAcknowledger interface {
+	AckUpdate(updateID int)
+}
+
 // LongPolling is a long-polling implementation of UpdateReceiver.
 // It sends /getUpdates requests, deserializes the response
-// and sends the updates to the channel
+// and sends the updates to the channel.
+//
+// Transient errors, such as network errors, server errors or flood control,
+// are retried with exponential backoff. Invalid or revoked API token and other client errors are fatal.
 type LongPolling struct {
-	Offset  int
-	Limit   int
+	Offset int
+	Limit  int
+	// The time in seconds Telegram waits for the updates before responding with none.
+	// It must be shorter than the Timeout of the sender's HTTP client, if it's set
 	Timeout int
 
+	// The delay before the first retry after a transient error,
+	// doubled after every following failed attempt.
+	// Defaults to 1 second
+	MinBackoff time.Duration
+	// The maximum delay between the retries.
+	// Defaults to 30 seconds
+	MaxBackoff time.Duration
+	// If true, ReceiveUpdates returns [ConflictError] when the updates are being received somewhere else,
+	// e.g. by another instance of the bot.
+	// Otherwise it keeps retrying, which is useful when the previous instance is still shutting down during the deploy
+	ExitOnConflict bool
+	// Keeps the offset between restarts. The offset is loaded once ReceiveUpdates is called,
+	// and saved after every received batch of updates.
+	// Optional
+	OffsetStore OffsetStore
+	// If true, the next batch of updates is requested only after every update of the current one is handled,
+	// so the updates are confirmed and the offset is saved only once they're handled.
+	// That gives at-least-once delivery across restarts at the cost of throughput:
+	// an update can be received again if the bot is stopped while handling it, but it's never lost.
+	// Otherwise, the updates are confirmed as soon as they're received.
+	CommitOnHandled bool
+	// If true, the webhook is deleted once ReceiveUpdates is called, if it's set,
+	// so the bot can receive updates with long polling.
+	// Otherwise the bot refuses to start while the webhook is set.
+	// Use it with care: a webhook set in production would stop receiving updates.
+	DeleteWebhook bool
+	// If true, the updates pending at the moment the webhook is deleted are dropped.
+	// Used only with DeleteWebhook
+	DropPendingUpdates bool
+
 	bot *Bot
+	// the offset after the last update sent to the channel
+	received int
+
+	mu        sync.Mutex
+	pending   map[int]struct{}
+	batchDone chan struct{}
 }
 
 // PairBot satisfies the UpdateReceiver interface
@@ -39,24 +95,48 @@ func (lp *LongPolling) PairBot(b *Bot) {
 }
 
 // ReceiveUpdates sends /getUpdates requests, deserializes the response
-// and sends the updates to the chUpdate
+// and sends the updates to the chUpdate.
+// It returns nil once ctx is done, or an error if the updates can't be received anymore
 func (lp *LongPolling) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) error {
 	if lp.bot.Sender == nil {
 		return fmt.Errorf("long polling bot requires request sender")
 	}
+	if lp.MinBackoff <= 0 {
+		lp.MinBackoff = time.Second
+	}
+	if lp.MaxBackoff < lp.MinBackoff {
+		lp.MaxBackoff = max(30*time.Second, lp.MinBackoff)
+	}
+	if s, ok := lp.bot.Sender.(*TGBotAPIRequestSender); ok && s.Client != nil && s.Client.Timeout > 0 &&
+		time.Duration(lp.Timeout)*time.Second >= s.Client.Timeout {
+		// every idle request would fail
+		return fmt.Errorf("long polling timeout (%ds) must be shorter than the HTTP client timeout (%s)", lp.Timeout, s.Client.Timeout)
+	}
 
-	allowedUpdates := make([]string, 0, len(lp.bot.updateHandlers))
-	for upd := range lp.bot.updateHandlers {
-		allowedUpdates = append(allowedUpdates, upd)
+	if lp.OffsetStore != nil {
+		offset, err := lp.OffsetStore.LoadOffset(ctx)
+		if err != nil {
+			return fmt.Errorf("loading offset: %w", err)
+		}
+		lp.Offset = max(lp.Offset, offset)
 	}
-	if len(lp.bot.commandHandlers.byCommand) > 0 && !slices.Contains(allowedUpdates, UpdateTypeMessage) {
-		allowedUpdates = append(allowedUpdates, UpdateTypeMessage)
+
+	if lp.DeleteWebhook {
+		lp.bot.Logger.Info("deleting webhook to receive updates with long polling", "drop pending updates", lp.DropPendingUpdates)
+		if err := lp.bot.deleteWebhook(ctx, lp.DropPendingUpdates); err != nil {
+			return err
+		}
 	}
 
+	allowedUpdates := lp.bot.allowedUpdates()
+
 	var (
-		get  GetUpdates
-		resp *APIResponse
-		err  error
+		get      GetUpdates
+		upds     []Update
+		next     int
+		code     int
+		attempts int
+		err      error
 	)
 
 	for {
@@ -71,33 +151,214 @@ func (lp *LongPolling) ReceiveUpdates(ctx context.Context, chUpdate chan<- Updat
 				AllowedUpdates: allowedUpdates,
 			}
 
-			resp, err = lp.bot.Sender.SendWithContext(ctx, &get)
-			if err != nil {
-				return fmt.Errorf("polling for updates: %w", err)
+			upds, next, code, err = lp.getUpdates(ctx, &get)
+			if ctx.Err() != nil {
+				// the bot is shutting down, so the request was cancelled
+				return nil
 			}
-			if !resp.Ok {
-				return resp.GetError()
+			if err != nil {
+				if lp.isFatal(code, err) {
+					return fmt.Errorf("polling for updates: %w", err)
+				}
+
+				delay := backoff(attempts, lp.MinBackoff, lp.MaxBackoff)
+				var errRateLimit TooManyRequestsError
+				if errors.As(err, &errRateLimit) {
+					delay = max(delay, errRateLimit.RetryAfter())
+				}
+				attempts++
+
+				lp.bot.Logger.Error(err, "polling for updates; retrying", "attempt", attempts, "delay", delay)
+				if !sleepContext(ctx, delay) {
+					return nil
+				}
+				continue
 			}
+			attempts = 0
 
-			var upds []Update
-			resp.BindResult(&upds)
-			
-			// to avoid any rate limits we are sleeping when there's no activity
-			if len(upds) == 0 {
-				time.Sleep(1 * time.Second)
+			if len(upds) > 0 && !lp.deliver(ctx, upds, chUpdate) {
+				// the rest of the updates will be received again after the restart
+				return nil
+			}
+			if next > lp.Offset {
+				// the batch ends with the updates which can't be decoded
+				lp.received = max(lp.received, next)
+				lp.Offset = next
+			}
+			if next == 0 {
+				// to avoid any rate limits we are sleeping when there's no activity,
+				// unless Telegram has already waited for the updates
+				if lp.Timeout == 0 && !sleepContext(ctx, lp.MinBackoff) {
+					return nil
+				}
 				continue
 			}
-			for _, upd := range upds {
-				chUpdate <- upd
-				lp.Offset = upd.UpdateID + 1
+			lp.saveOffset(ctx)
+		}
+	}
+}
+
+// deliver sends the updates to chUpdate and advances the offset.
+// If [LongPolling.CommitOnHandled] is set, it waits until every update is handled.
+// It returns false if ctx is done before that
+func (lp *LongPolling) deliver(ctx context.Context, upds []Update, chUpdate chan<- Update) bool {
+	var done <-chan struct{}
+	if lp.CommitOnHandled {
+		done = lp.startBatch(upds)
+	}
+
+	for _, upd := range upds {
+		select {
+		case chUpdate <- upd:
+			lp.received = upd.UpdateID + 1
+			if !lp.CommitOnHandled {
+				lp.Offset = lp.received
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if lp.CommitOnHandled {
+		select {
+		case <-done:
+			lp.Offset = upds[len(upds)-1].UpdateID + 1
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// startBatch remembers the updates which must be handled before the next request.
+// The returned channel is closed once they're handled
+func (lp *LongPolling) startBatch(upds []Update) <-chan struct{} {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	lp.pending = make(map[int]struct{}, len(upds))
+	for _, upd := range upds {
+		lp.pending[upd.UpdateID] = struct{}{}
+	}
+	lp.batchDone = make(chan struct{})
+	return lp.batchDone
+}
+
+// AckUpdate satisfies the UpdateAcknowledger interface
+func (lp *LongPolling) AckUpdate(updateID int) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	if _, ok := lp.pending[updateID]; !ok {
+		return
+	}
+	delete(lp.pending, updateID)
+	if len(lp.pending) == 0 {
+		close(lp.batchDone)
+	}
+}
+
+func (lp *LongPolling) saveOffset(ctx context.Context) {
+	if lp.OffsetStore == nil {
+		return
+	}
+	if err := lp.OffsetStore.SaveOffset(ctx, lp.Offset); err != nil {
+		lp.bot.Logger.Error(err, "saving offset", "offset", lp.Offset)
+	}
+}
+
+// getUpdates returns the received updates and the offset after the last one, or 0 if there are none,
+// or an error with the response's error code, if there's any.
+// The updates which can't be decoded are logged and skipped,
+// otherwise they would be received again and again
+func (lp *LongPolling) getUpdates(ctx context.Context, get *GetUpdates) ([]Update, int, int, error) {
+	resp, err := lp.bot.Sender.SendWithContext(ctx, get)
+	if resp != nil && err == nil {
+		err = resp.GetError()
+	}
+	if err != nil {
+		if resp != nil {
+			return nil, 0, resp.ErrorCode, err
+		}
+		return nil, 0, 0, err
+	}
+
+	var raw []json.RawMessage
+	if err = json.Unmarshal(resp.Result, &raw); err != nil {
+		return nil, 0, 0, fmt.Errorf("decoding updates: %w", err)
+	}
+
+	upds := make([]Update, 0, len(raw))
+	next := 0
+	for _, r := range raw {
+		// not using BindResult, because the updates may contain the fields unknown to this version of the library
+		var upd Update
+		if err = json.Unmarshal(r, &upd); err != nil {
+			var id struct {
+				UpdateID int `json:"update_id"`
+			}
+			if idErr := json.Unmarshal(r, &id); idErr != nil {
+				lp.bot.Logger.Error(err, "skipping the update which can't be decoded")
+				continue
 			}
+			lp.bot.Logger.Error(err, "skipping the update which can't be decoded", "ID", id.UpdateID)
+			next = max(next, id.UpdateID+1)
+			continue
 		}
+		upds = append(upds, upd)
+		next = max(next, upd.UpdateID+1)
 	}
+	return upds, next, 0, nil
+}
+
+// isFatal reports whether the error won't go away by retrying the request
+func (lp *LongPolling) isFatal(code int, err error) bool {
+	var (
+		errUnauthorized UnauthorizedError
+		errConflict     ConflictError
+		errRateLimit    TooManyRequestsError
+	)
+
+	switch {
+	case errors.As(err, &errUnauthorized):
+		return true
+	case errors.As(err, &errConflict):
+		return lp.ExitOnConflict
+	case errors.As(err, &errRateLimit):
+		return false
+	}
+	return code >= 400 && code < 500
+}
+
+// CommitOffset confirms every update received so far and saves the offset into [LongPolling.OffsetStore],
+// so they won't be received again after the restart.
+// Telegram confirms the updates only on the next /getUpdates request,
+// so it's called by [Bot.Shutdown] once every received update is handled.
+func (lp *LongPolling) CommitOffset(ctx context.Context) error {
+	lp.Offset = max(lp.Offset, lp.received)
+	if lp.Offset == 0 {
+		return nil
+	}
+
+	if lp.OffsetStore != nil {
+		if err := lp.OffsetStore.SaveOffset(ctx, lp.Offset); err != nil {
+			return fmt.Errorf("saving offset: %w", err)
+		}
+	}
+
+	resp, err := lp.bot.Sender.SendWithContext(ctx, &GetUpdates{Offset: lp.Offset, Limit: 1})
+	if err != nil {
+		return fmt.Errorf("sending getUpdates request: %w", err)
+	}
+	return resp.GetError()
 }
 
 // Webhook is a implementation for UpdateReceiver,
 // which creates a server on a given ListenAddr
-// and sends /setWebhook request with URL "Host:ExposedPort/Path"
+// and sends /setWebhook request with URL "Host:ExposedPort/Path".
+//
+// Webhook is also an [http.Handler], so it can be mounted on an existing server instead,
+// see [Webhook.DisableServer].
 type Webhook struct {
 	// In format https://example.com
 	Host string
@@ -108,6 +369,54 @@ type Webhook struct {
 	ExposedPort string
 	// Will be used to run the webhook server
 	ListenAddr string
+	// If true, no server is created: ReceiveUpdates only sends /setWebhook request
+	// and waits until the bot is stopped, while the updates are received by the Webhook itself,
+	// mounted as an [http.Handler] on the server of your own.
+	// In that case, ListenAddr is ignored,
+	// and Host, ExposedPort and Path must match the URL the handler is reachable at.
+	DisableServer bool
+	// Paths to the certificate and its private key used to serve HTTPS.
+	// If empty, the server serves plain HTTP, which is useful only behind a reverse proxy terminating TLS.
+	// If the certificate is self-signed, its public part must also be uploaded as Certificate.
+	TLSCertFile string
+	TLSKeyFile  string
+	// If true, a self-signed certificate is generated for the domain name or the IP address from Host,
+	// the server uses it to serve HTTPS, and it's uploaded with /setWebhook instead of Certificate.
+	// TLSCertFile and TLSKeyFile are ignored in that case.
+	// The certificate is generated again on every launch.
+	SelfSigned bool
+	// If true, every update is handled right in the webhook request, bypassing the worker pool,
+	// and the first request sent by the handler is written into the response instead of being sent,
+	// which saves a round trip. The result of such request is unknown:
+	// the handler gets a successful [APIResponse] with no result,
+	// and the helpers like [Context.Reply] return nil message.
+	// Only the methods sending, forwarding, copying, editing or deleting messages and answering queries
+	// can be written into the response, others, as well as the requests uploading files, are sent as usual.
+	// The requests getting something, like /getChatMember, are always sent and don't count as the first one.
+	// Note that the requests sent after the first one may be executed by Telegram before it.
+	// Since the updates are handled concurrently, in as many requests as Telegram sends,
+	// it can't be used with [Bot.ShardBy], [Webhook.ReceiveUpdates] returns an error in that case.
+	ReplyInResponse bool
+	// The maximum size of the request body in bytes.
+	// Defaults to 1 MB
+	MaxBodySize int64
+	// How long to wait for a free worker before responding with 503 Service Unavailable,
+	// so Telegram sends the update again later.
+	// Zero means waiting for as long as Telegram waits for the response
+	EnqueueTimeout time.Duration
+	// If true, only the requests from [TelegramSubnets] are accepted, others get 403 Forbidden
+	AllowTelegramIPsOnly bool
+	// Subnets of the reverse proxies trusted to set X-Forwarded-For header, e.g. "10.0.0.0/8".
+	// Used only with AllowTelegramIPsOnly, the header is ignored if the request comes from anywhere else
+	TrustedProxies []string
+	// How many recent update IDs are remembered to drop the updates which Telegram sends again,
+	// e.g. when the previous response took too long.
+	// Defaults to 1000, negative value disables it
+	DedupWindow int
+	// If true, the webhook is deleted once the bot stops receiving updates,
+	// so the pending updates can be received by another instance, e.g. with long polling.
+	// DropPendingUpdates is used for that request too
+	DeleteOnShutdown bool
 	// Optional.
 	Certificate InputFile
 	// Optional.
@@ -119,25 +428,67 @@ type Webhook struct {
 	// Optional.
 	SecretToken string
 
-	bot *Bot
+	bot        *Bot
+	selfSigned *selfSignedCertificate
+
+	// set while the updates are being received, see ServeHTTP
+	mu       sync.RWMutex
+	ctx      context.Context
+	chUpdate chan<- Update
+	trusted  []netip.Prefix
+	seen     *recentIDs
 }
 
-// ReceiveUpdates creates a webhook server which will send every incoming update into chUpdate
-func (ws *Webhook) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) (err error) {
+// ReceiveUpdates creates a webhook server which will send every incoming update into chUpdate.
+// If [Webhook.DisableServer] is set, it only sets the webhook,
+// and the updates are received by [Webhook.ServeHTTP]
+func (ws *Webhook) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) error {
 	if ws.bot.Sender == nil {
 		return fmt.Errorf("can't set webhook: no request sender")
 	}
+	if ws.ReplyInResponse && ws.bot.ShardBy != nil {
+		return fmt.Errorf("can't reply in response with sharded workers: the updates would bypass them")
+	}
+	if !strings.HasPrefix(ws.Path, "/") {
+		ws.Path = "/" + ws.Path
+	}
+	if port := strings.TrimPrefix(ws.ExposedPort, ":"); port != "" && !slices.Contains(webhookPorts, port) {
+		return fmt.Errorf("webhook can be set only on ports %s, got %s", strings.Join(webhookPorts, ", "), port)
+	}
+	if ws.SelfSigned {
+		if ws.DisableServer {
+			return fmt.Errorf("can't use self-signed certificate without the webhook server")
+		}
+		if err := ws.generateCertificate(); err != nil {
+			return fmt.Errorf("generating self-signed certificate: %w", err)
+		}
+	}
 
-	allowedUpdates := make([]string, 0, len(ws.bot.updateHandlers))
-	for upd := range ws.bot.updateHandlers {
-		allowedUpdates = append(allowedUpdates, upd)
+	trusted, err := parsePrefixes(ws.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
 	}
-	if len(ws.bot.commandHandlers.byCommand) > 0 && !slices.Contains(allowedUpdates, UpdateTypeMessage) {
-		allowedUpdates = append(allowedUpdates, UpdateTypeMessage)
+
+	ws.start(ctx, chUpdate, trusted)
+	defer ws.stop()
+	if ws.DeleteOnShutdown {
+		defer ws.deleteOnShutdown(ctx)
+	}
+
+	allowedUpdates := ws.bot.allowedUpdates()
+
+	if ws.DisableServer {
+		if err := ws.SetWebhook(ctx, allowedUpdates); err != nil {
+			return err
+		}
+		ws.bot.Logger.Info("webhook is set, receiving updates with the external server", "url", ws.WebhookURL())
+
+		<-ctx.Done()
+		return ctx.Err()
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc(ws.Path, ws.handlerFunc(chUpdate))
+	mux.Handle(ws.Path, ws)
 
 	if ws.ListenAddr == "" {
 		ws.ListenAddr = ":443"
@@ -146,17 +497,17 @@ func (ws *Webhook) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) (
 		Addr:    ws.ListenAddr,
 		Handler: mux,
 	}
-	serverErr := make(chan error, 1)
+	serverErr := make(chan error, 2)
 
 	go func() {
-		if err = ws.SetWebhook(ctx, allowedUpdates); err != nil {
-			serverErr <- fmt.Errorf("setting webhook: %w", err)
+		if err := ws.SetWebhook(ctx, allowedUpdates); err != nil {
+			serverErr <- err
 		}
 	}()
 
 	go func() {
 		ws.bot.Logger.Info("webhook server is listening and serving on", "address", ws.ListenAddr, "exposed port", ws.ExposedPort, "path", ws.Path)
-		if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := ws.listenAndServe(server); err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 		}
 	}()
@@ -167,7 +518,7 @@ func (ws *Webhook) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) (
 
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		if err = server.Shutdown(shutdownCtx); err != nil {
+		if err := server.Shutdown(shutdownCtx); err != nil {
 			ws.bot.Logger.Error(err, "error shutting down webhook server")
 			return err
 		}
@@ -175,12 +526,73 @@ func (ws *Webhook) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) (
 		ws.bot.Logger.Info("webhook server is stopped")
 		return ctx.Err()
 
-	case err = <-serverErr:
+	case err := <-serverErr:
 		ws.bot.Logger.Error(err, "server error")
+
+		// the server may still be running if it's the webhook that has failed
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
 		return err
 	}
 }
 
+// Telegram sends webhook requests only to these ports
+var webhookPorts = []string{"443", "80", "88", "8443"}
+
+func (ws *Webhook) generateCertificate() error {
+	u, err := url.Parse(ws.Host)
+	if err != nil {
+		return fmt.Errorf("parsing host: %w", err)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("host must be in format https://example.com, got %s", ws.Host)
+	}
+
+	ws.selfSigned, err = generateCertificate(u.Hostname())
+	return err
+}
+
+func (ws *Webhook) listenAndServe(server *http.Server) error {
+	switch {
+	case ws.selfSigned != nil:
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{ws.selfSigned.tls}}
+		return server.ListenAndServeTLS("", "")
+	case ws.TLSCertFile != "" || ws.TLSKeyFile != "":
+		return server.ListenAndServeTLS(ws.TLSCertFile, ws.TLSKeyFile)
+	default:
+		return server.ListenAndServe()
+	}
+}
+
+// start makes ServeHTTP send the updates into chUpdate
+func (ws *Webhook) start(ctx context.Context, chUpdate chan<- Update, trusted []netip.Prefix) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.ctx, ws.chUpdate, ws.trusted = ctx, chUpdate, trusted
+
+	if ws.MaxBodySize <= 0 {
+		ws.MaxBodySize = 1 << 20
+	}
+	if ws.DedupWindow == 0 {
+		ws.DedupWindow = 1000
+	}
+	ws.seen = nil
+	if ws.DedupWindow > 0 {
+		ws.seen = newRecentIDs(ws.DedupWindow)
+	}
+}
+
+// stop waits for ServeHTTP to stop sending updates,
+// so chUpdate can be safely closed afterwards
+func (ws *Webhook) stop() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.ctx, ws.chUpdate = nil, nil
+}
+
 // PairBot satisfies the UpdateReceiver interface
 func (wh *Webhook) PairBot(b *Bot) {
 	wh.bot = b
@@ -208,9 +620,14 @@ func (ws *Webhook) SetWebhook(ctx context.Context, allowedUpdates []string) erro
 	if ws.bot == nil || ws.bot.Sender == nil {
 		return fmt.Errorf("webhook is not paired with bot")
 	}
+	cert := ws.Certificate
+	if ws.selfSigned != nil {
+		cert = InputFileLocal{Name: "cert.pem", Data: bytes.NewReader(ws.selfSigned.pem)}
+	}
+
 	swh := SetWebhook{
 		URL:                ws.WebhookURL(),
-		Certificate:        ws.Certificate,
+		Certificate:        cert,
 		IPAddress:          ws.IPAddress,
 		MaxConnections:     ws.MaxConnections,
 		AllowedUpdates:     allowedUpdates,
@@ -227,43 +644,209 @@ func (ws *Webhook) SetWebhook(ctx context.Context, allowedUpdates []string) erro
 	return nil
 }
 
-func (ws *Webhook) handlerFunc(chUpdate chan<- Update) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
+// deleteOnShutdown deletes the webhook once ReceiveUpdates is about to return,
+// see [Webhook.DeleteOnShutdown]
+func (ws *Webhook) deleteOnShutdown(ctx context.Context) {
+	// ctx is most likely done by now
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if err := ws.bot.deleteWebhook(ctx, ws.DropPendingUpdates); err != nil {
+		ws.bot.Logger.Error(err, "failed to delete webhook on shutdown")
+		return
+	}
+	ws.bot.Logger.Info("webhook is deleted")
+}
+
+// ServeHTTP receives the update sent by Telegram,
+// so the Webhook can be mounted on the server of your own, see [Webhook.DisableServer].
+// It responds with 503 Service Unavailable when the bot is not receiving updates.
+func (ws *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
 
-		if r.Method != "POST" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if ws.SecretToken != "" {
+		t := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if ws.SecretToken != t {
+			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		if ws.SecretToken != "" {
-			t := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
-			if ws.SecretToken != t {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-		}
+	}
 
-		var err error
-		buf := reused.Buf()
-		defer reused.PutBuf(buf)
+	// the body is read without holding the lock, so a slow client can't delay the shutdown
+	ws.mu.RLock()
+	running, trusted, maxBodySize := ws.chUpdate != nil, ws.trusted, ws.MaxBodySize
+	ws.mu.RUnlock()
 
-		_, err = io.Copy(buf, r.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusRequestEntityTooLarge)
-			ws.bot.Logger.Error(err, "reading request body")
+	if !running {
+		// Telegram will send it again
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if ws.AllowTelegramIPsOnly {
+		addr, ok := clientAddr(r, trusted)
+		if !ok || !containsAddr(TelegramSubnets, addr) {
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
+	}
 
-		dec := json.NewDecoder(buf)
-		// dec.DisallowUnknownFields() //FIXME:
-		var upd Update
-		if err = dec.Decode(&upd); err != nil {
+	var err error
+	buf := reused.Buf()
+	defer reused.PutBuf(buf)
+
+	_, err = io.Copy(buf, http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var errTooLarge *http.MaxBytesError
+		if errors.As(err, &errTooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else {
 			w.WriteHeader(http.StatusBadRequest)
-			ws.bot.Logger.Error(err, "parsing request body")
-			return
 		}
+		ws.bot.Logger.Error(err, "reading request body")
+		return
+	}
+
+	dec := json.NewDecoder(buf)
+	// dec.DisallowUnknownFields() //FIXME:
+	var upd Update
+	if err = dec.Decode(&upd); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		ws.bot.Logger.Error(err, "parsing request body")
+		return
+	}
+
+	if ws.ReplyInResponse {
+		body, ok := ws.respond(&upd)
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case body == nil:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+		}
+		return
+	}
+
+	w.WriteHeader(ws.accept(r.Context(), upd))
+}
+
+// accept sends the update to the channel, unless it's received again,
+// and returns the status code of the response
+func (ws *Webhook) accept(ctx context.Context, upd Update) int {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	if ws.chUpdate == nil {
+		// stopped while the body was being read
+		return http.StatusServiceUnavailable
+	}
+	if ws.seen != nil && !ws.seen.add(upd.UpdateID) {
+		ws.bot.Logger.Info("dropping the update received again", "ID", upd.UpdateID)
+		return http.StatusOK
+	}
+
+	if ws.enqueue(ctx, upd) {
+		return http.StatusOK
+	}
+	if ws.seen != nil {
+		// it must be accepted when Telegram sends it again
+		ws.seen.remove(upd.UpdateID)
+	}
+	return http.StatusServiceUnavailable
+}
+
+// enqueue sends the update to the channel, waiting no longer than [Webhook.EnqueueTimeout].
+// It returns false if the update wasn't sent
+func (ws *Webhook) enqueue(ctx context.Context, upd Update) bool {
+	if ws.EnqueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ws.EnqueueTimeout)
+		defer cancel()
+	}
+
+	select {
+	case ws.chUpdate <- upd:
+		return true
+	case <-ws.ctx.Done():
+		return false
+	case <-ctx.Done():
+		ws.bot.Logger.Info("no free worker for the update, asking Telegram to send it later", "ID", upd.UpdateID)
+		return false
+	}
+}
+
+// respond handles the update and returns the first request sent by the handler to write it into the response,
+// see [Webhook.ReplyInResponse]. It returns false if the webhook is stopped
+func (ws *Webhook) respond(upd *Update) ([]byte, bool) {
+	// the shutdown waits for the handler, just like for the updates handled by the workers
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	if ws.chUpdate == nil {
+		// stopped while the body was being read
+		return nil, false
+	}
+	if ws.seen != nil && !ws.seen.add(upd.UpdateID) {
+		ws.bot.Logger.Info("dropping the update received again", "ID", upd.UpdateID)
+		return nil, true
+	}
+
+	var response webhookResponse
+	ws.bot.handleUpdate(upd, &response)
+	return response.body, true
+}
+
+// AutoReceiver picks the way to receive updates from the configuration:
+// [Webhook] if its Host is set, e.g. in production, and [LongPolling] otherwise, e.g. locally.
+// Once it's paired with the bot, it's replaced by the chosen receiver.
+type AutoReceiver struct {
+	// Used if its Host is set.
+	// Optional
+	Webhook *Webhook
+	// Used if there's no Webhook or its Host is empty.
+	// Defaults to LongPolling with 30 seconds timeout
+	LongPolling *LongPolling
+	// The name of the environment variable to read the webhook Host from, e.g. "WEBHOOK_HOST",
+	// if the Host is empty. If Webhook is nil, the one with default settings is used.
+	// Optional
+	HostEnv string
+}
+
+// Receiver returns the chosen receiver
+func (ar *AutoReceiver) Receiver() UpdateReceiver {
+	if host := os.Getenv(ar.HostEnv); ar.HostEnv != "" && host != "" {
+		if ar.Webhook == nil {
+			ar.Webhook = &Webhook{}
+		}
+		if ar.Webhook.Host == "" {
+			ar.Webhook.Host = host
+		}
+	}
+	if ar.Webhook != nil && ar.Webhook.Host != "" {
+		return ar.Webhook
+	}
 
-		chUpdate <- upd
-		w.WriteHeader(http.StatusOK)
+	if ar.LongPolling == nil {
+		ar.LongPolling = &LongPolling{Timeout: 30, Limit: 100}
 	}
+	return ar.LongPolling
+}
+
+// PairBot satisfies the UpdateReceiver interface.
+// It pairs the chosen receiver with the bot instead of itself
+func (ar *AutoReceiver) PairBot(b *Bot) {
+	ar.Receiver().PairBot(b)
+}
+
+// ReceiveUpdates satisfies the UpdateReceiver interface.
+// It's used only if the AutoReceiver wasn't paired with the bot
+func (ar *AutoReceiver) ReceiveUpdates(ctx context.Context, chUpdate chan<- Update) error {
+	return ar.Receiver().ReceiveUpdates(ctx, chUpdate)
 }
@@ -0,0 +1,510 @@
+package botify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedResponse is the result of a single request sent by scriptedSender
+type scriptedResponse struct {
+	Resp *APIResponse
+	Err  error
+}
+
+// scriptedSender responds to /getUpdates requests in the given order,
+// and with an empty list of updates once the script is over
+type scriptedSender struct {
+	testSender
+
+	mu     sync.Mutex
+	script []scriptedResponse
+}
+
+func (s *scriptedSender) Send(obj APIMethod) (*APIResponse, error) {
+	return s.SendWithContext(context.Background(), obj)
+}
+
+func (s *scriptedSender) SendWithContext(ctx context.Context, obj APIMethod) (*APIResponse, error) {
+	s.testSender.SendWithContext(ctx, obj)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.script) == 0 {
+		return &APIResponse{Ok: true, Result: []byte("[]")}, nil
+	}
+	r := s.script[0]
+	s.script = s.script[1:]
+	if r.Resp != nil && !r.Resp.Ok {
+		return r.Resp, r.Resp.GetError()
+	}
+	return r.Resp, r.Err
+}
+
+func TestLongPolling_ReceiveUpdates(t *testing.T) {
+	updates := &APIResponse{Ok: true, Result: []byte(`[{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}]`)}
+
+	tests := []struct {
+		name           string
+		script         []scriptedResponse
+		exitOnConflict bool
+		wantUpdates    int
+		wantErr        any
+	}{
+		{
+			name: "transient errors are retried",
+			script: []scriptedResponse{
+				{Err: errors.New("connection reset by peer")},
+				{Resp: &APIResponse{ErrorCode: 502, Description: "Bad Gateway"}},
+				{Resp: &APIResponse{ErrorCode: 429, Description: "Too Many Requests", Parameters: &ResponseParameters{RetryAfter: new(int)}}},
+				{Resp: updates},
+			},
+			wantUpdates: 1,
+		},
+		{
+			name:    "unauthorized is fatal",
+			script:  []scriptedResponse{{Resp: &APIResponse{ErrorCode: 401, Description: "Unauthorized"}}},
+			wantErr: new(UnauthorizedError),
+		},
+		{
+			name: "conflict is retried by default",
+			script: []scriptedResponse{
+				{Resp: &APIResponse{ErrorCode: 409, Description: "Conflict: terminated by other getUpdates request"}},
+				{Resp: updates},
+			},
+			wantUpdates: 1,
+		},
+		{
+			name: "updates which can't be decoded are skipped",
+			script: []scriptedResponse{{Resp: &APIResponse{Ok: true, Result: []byte(`[
+				{"update_id":0,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}},
+				{"update_id":1,"message":{"message_id":"2","date":0,"chat":{"id":1,"type":"private"}}}
+			]`)}}},
+			wantUpdates: 1,
+		},
+		{
+			name:           "conflict is fatal if asked",
+			script:         []scriptedResponse{{Resp: &APIResponse{ErrorCode: 409, Description: "Conflict: terminated by other getUpdates request"}}},
+			exitOnConflict: true,
+			wantErr:        new(ConflictError),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp := &LongPolling{Limit: 100, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, ExitOnConflict: tt.exitOnConflict}
+			b := &Bot{Token: "1:token", Sender: &scriptedSender{script: tt.script}, Receiver: lp, Logger: logr.Discard()}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			b.init(ctx)
+
+			chUpdate := make(chan Update, 10)
+			done := make(chan error)
+			go func() { done <- lp.ReceiveUpdates(ctx, chUpdate) }()
+
+			if tt.wantErr != nil {
+				assert.ErrorAs(t, <-done, tt.wantErr)
+				return
+			}
+
+			for range tt.wantUpdates {
+				<-chUpdate
+			}
+			cancel()
+			assert.NoError(t, <-done)
+			assert.Equal(t, 2, lp.Offset)
+		})
+	}
+}
+
+func TestLongPolling_NoUpdates(t *testing.T) {
+	sender := &scriptedSender{}
+	lp := &LongPolling{MinBackoff: 20 * time.Millisecond}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: lp, Logger: logr.Discard()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	b.init(ctx)
+
+	assert.NoError(t, lp.ReceiveUpdates(ctx, make(chan Update)))
+	assert.LessOrEqual(t, len(sender.Sent()), 3, "with no timeout, the updates are requested no more often than MinBackoff")
+}
+
+func TestLongPolling_IdlePoll(t *testing.T) {
+	timeout := defaultRequestTimeout
+	defaultRequestTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { defaultRequestTimeout = timeout })
+
+	// Telegram holds the request for the whole long polling timeout
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":[{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}]}`))
+	}))
+	defer ts.Close()
+
+	lp := &LongPolling{Limit: 100, Timeout: 1}
+	sender := &TGBotAPIRequestSender{APIToken: "1:token", APIHost: ts.URL}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: lp, Logger: logr.Discard()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.init(ctx)
+
+	chUpdate := make(chan Update, 1)
+	done := make(chan error)
+	go func() { done <- lp.ReceiveUpdates(ctx, chUpdate) }()
+
+	select {
+	case upd := <-chUpdate:
+		assert.Equal(t, 1, upd.UpdateID)
+		assert.Equal(t, int32(1), requests.Load(), "the request must not expire while Telegram waits for the updates")
+	case err := <-done:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no updates received")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestLongPolling_ClientTimeout(t *testing.T) {
+	lp := &LongPolling{Timeout: 30}
+	sender := &TGBotAPIRequestSender{APIToken: "1:token", Client: &http.Client{Timeout: 30 * time.Second}}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: lp, Logger: logr.Discard()}
+	b.init(context.Background())
+
+	assert.ErrorContains(t, lp.ReceiveUpdates(context.Background(), make(chan Update)), "must be shorter than the HTTP client timeout")
+}
+
+func TestLongPolling_CommitOnHandled(t *testing.T) {
+	batch := &APIResponse{Ok: true, Result: []byte(`[{"update_id":10},{"update_id":11}]`)}
+	sender := &scriptedSender{script: []scriptedResponse{{Resp: batch}}}
+	store := &MemoryOffsetStore{}
+	assert.NoError(t, store.SaveOffset(context.Background(), 10))
+
+	lp := &LongPolling{Limit: 100, OffsetStore: store, CommitOnHandled: true}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: lp, Logger: logr.Discard()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.init(ctx)
+
+	chUpdate := make(chan Update, 10)
+	done := make(chan error)
+	go func() { done <- lp.ReceiveUpdates(ctx, chUpdate) }()
+
+	first, second := <-chUpdate, <-chUpdate
+	lp.AckUpdate(second.UpdateID)
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Len(t, sender.Sent(), 1, "the next batch must not be requested until every update is handled")
+	offset, _ := store.LoadOffset(context.Background())
+	assert.Equal(t, 10, offset)
+
+	lp.AckUpdate(first.UpdateID)
+	assert.Eventually(t, func() bool {
+		offset, _ := store.LoadOffset(context.Background())
+		return offset == 12
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+	if get, ok := sender.Sent()[1].(*GetUpdates); assert.True(t, ok) {
+		assert.Equal(t, 12, get.Offset)
+	}
+}
+
+func TestWebhook_ServeHTTP(t *testing.T) {
+	sender := &testSender{}
+	wh := &Webhook{Host: "https://example.com", Path: "/bot", SecretToken: "secret", DisableServer: true}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: wh, Logger: logr.Discard()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.init(ctx)
+
+	post := func(token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/bot", strings.NewReader(`{"update_id":1}`))
+		r.Header.Set("X-Telegram-Bot-Api-Secret-Token", token)
+		w := httptest.NewRecorder()
+		wh.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, post("secret"), "the bot is not receiving updates yet")
+
+	chUpdate := make(chan Update, 1)
+	done := make(chan error)
+	go func() { done <- wh.ReceiveUpdates(ctx, chUpdate) }()
+
+	assert.Eventually(t, func() bool { return len(sender.Sent()) == 1 }, time.Second, time.Millisecond)
+	if swh, ok := sender.Sent()[0].(*SetWebhook); assert.True(t, ok) {
+		assert.Equal(t, "https://example.com/bot", swh.URL)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong"))
+	assert.Equal(t, http.StatusOK, post("secret"))
+	assert.Equal(t, 1, (<-chUpdate).UpdateID)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, http.StatusServiceUnavailable, post("secret"))
+}
+
+func TestWebhook_ReplyInResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      HandlerFunc
+		wantBody     string
+		wantSent     int
+		wantUploaded string
+	}{
+		{
+			name: "first request is written into the response",
+			handler: func(ctx *Context) error {
+				msg, err := ctx.Respond("hi")
+				assert.Nil(t, msg)
+				if err != nil {
+					return err
+				}
+				_, err = ctx.Respond("there")
+				return err
+			},
+			wantBody: `{"method":"sendMessage","chat_id":"1","text":"hi"}`,
+			wantSent: 1,
+		},
+		{
+			name: "files are sent as usual",
+			handler: func(ctx *Context) error {
+				_, err := ctx.ReplyPhoto(InputFileLocal{Name: "photo.jpg", Data: strings.NewReader("photo bytes")})
+				return err
+			},
+			wantSent:     1,
+			wantUploaded: "photo bytes",
+		},
+		{
+			name: "requests getting something are sent as usual",
+			handler: func(ctx *Context) error {
+				resp, err := ctx.SendRequest(&GetChatMember{ChatID: "1", UserID: 1})
+				if err != nil {
+					return err
+				}
+				assert.NotEmpty(t, resp.Result)
+				_, err = ctx.Respond("hi")
+				return err
+			},
+			wantBody: `{"method":"sendMessage","chat_id":"1","text":"hi"}`,
+			wantSent: 1,
+		},
+		{
+			name:    "nothing to respond with",
+			handler: func(ctx *Context) error { return nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &testSender{Result: []byte(`{"message_id":2,"date":0,"chat":{"id":1,"type":"private"}}`)}
+			wh := &Webhook{Host: "https://example.com", Path: "/bot", DisableServer: true, ReplyInResponse: true}
+			b := &Bot{Token: "1:token", Sender: sender, Receiver: wh, Logger: logr.Discard()}
+			b.Handle(UpdateTypeMessage, tt.handler)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			b.init(ctx)
+			go wh.ReceiveUpdates(ctx, make(chan Update))
+			assert.Eventually(t, func() bool { return len(sender.Sent()) == 1 }, time.Second, time.Millisecond)
+
+			body := `{"update_id":1,"message":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`
+			w := httptest.NewRecorder()
+			wh.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/bot", strings.NewReader(body)))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+			} else {
+				assert.Empty(t, w.Body.String())
+			}
+			// the first one is /setWebhook
+			assert.Len(t, sender.Sent(), 1+tt.wantSent)
+			if tt.wantUploaded != "" {
+				// the test sender doesn't read the payload, so it must be intact
+				var buf bytes.Buffer
+				_, err := sender.Sent()[1].WritePayload(&buf)
+				assert.NoError(t, err)
+				assert.Contains(t, buf.String(), tt.wantUploaded)
+			}
+		})
+	}
+}
+
+func TestWebhook_Guards(t *testing.T) {
+	sender := &testSender{}
+	wh := &Webhook{
+		Host:                 "https://example.com",
+		Path:                 "/bot",
+		DisableServer:        true,
+		MaxBodySize:          64,
+		EnqueueTimeout:       10 * time.Millisecond,
+		AllowTelegramIPsOnly: true,
+		TrustedProxies:       []string{"10.0.0.0/8"},
+	}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: wh, Logger: logr.Discard()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.init(ctx)
+
+	chUpdate := make(chan Update, 1)
+	go wh.ReceiveUpdates(ctx, chUpdate)
+	assert.Eventually(t, func() bool { return len(sender.Sent()) == 1 }, time.Second, time.Millisecond)
+
+	post := func(remote, forwarded, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/bot", strings.NewReader(body))
+		r.RemoteAddr = remote
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		wh.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	const telegram = "149.154.167.1:443"
+	assert.Equal(t, http.StatusForbidden, post("1.2.3.4:443", "", `{"update_id":1}`))
+	assert.Equal(t, http.StatusForbidden, post("1.2.3.4:443", "149.154.167.1", `{"update_id":1}`), "untrusted proxy")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(telegram, "", `{"update_id":1,"padding":"`+strings.Repeat("a", 64)+`"}`))
+
+	assert.Equal(t, http.StatusOK, post("10.0.0.1:443", "1.2.3.4, 149.154.167.1", `{"update_id":1}`))
+	assert.Equal(t, http.StatusOK, post(telegram, "", `{"update_id":1}`), "received again")
+	assert.Len(t, chUpdate, 1)
+
+	// the channel is full and nobody reads it
+	assert.Equal(t, http.StatusServiceUnavailable, post(telegram, "", `{"update_id":2}`))
+	assert.Equal(t, 1, (<-chUpdate).UpdateID)
+	assert.Equal(t, http.StatusOK, post(telegram, "", `{"update_id":2}`), "accepted when sent again")
+	assert.Equal(t, 2, (<-chUpdate).UpdateID)
+}
+
+func TestWebhook_SlowClient(t *testing.T) {
+	wh := &Webhook{Host: "https://example.com", DisableServer: true}
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Receiver: wh, Logger: logr.Discard()}
+	b.init(context.Background())
+	wh.start(context.Background(), make(chan Update, 1), nil)
+
+	body, write := io.Pipe()
+	w := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		wh.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", body))
+	}()
+
+	// the client is still sending the body
+	write.Write([]byte(`{"update_id":`))
+	stopped := make(chan struct{})
+	go func() {
+		wh.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the webhook can't be stopped while the body is being read")
+	}
+
+	write.Write([]byte(`1}`))
+	write.Close()
+	<-served
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "the update received after the stop is rejected")
+}
+
+func TestWebhook_InvalidTrustedProxies(t *testing.T) {
+	wh := &Webhook{Host: "https://example.com", DisableServer: true, TrustedProxies: []string{"10.0.0.1"}}
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Receiver: wh, Logger: logr.Discard()}
+	b.init(context.Background())
+
+	assert.Error(t, wh.ReceiveUpdates(context.Background(), make(chan Update)))
+}
+
+func TestWebhook_ReplyInResponseWithShardBy(t *testing.T) {
+	wh := &Webhook{Host: "https://example.com", DisableServer: true, ReplyInResponse: true}
+	sender := &testSender{}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: wh, Logger: logr.Discard(), ShardBy: ShardByChat}
+	b.init(context.Background())
+
+	assert.ErrorContains(t, wh.ReceiveUpdates(context.Background(), make(chan Update)), "sharded workers")
+	assert.Empty(t, sender.Sent(), "the webhook isn't set")
+}
+
+func TestWebhook_DeleteOnShutdown(t *testing.T) {
+	sender := &testSender{}
+	wh := &Webhook{Host: "https://example.com", DisableServer: true, DeleteOnShutdown: true}
+	b := &Bot{Token: "1:token", Sender: sender, Receiver: wh, Logger: logr.Discard()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.init(ctx)
+	done := make(chan error)
+	go func() { done <- wh.ReceiveUpdates(ctx, make(chan Update)) }()
+
+	assert.Eventually(t, func() bool { return len(sender.Sent()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	if sent := sender.Sent(); assert.Len(t, sent, 2) {
+		assert.IsType(t, &DeleteWebhook{}, sent[1])
+	}
+}
+
+func TestAutoReceiver(t *testing.T) {
+	tests := []struct {
+		name string
+		ar   *AutoReceiver
+		env  string
+		want string
+	}{
+		{name: "default", ar: &AutoReceiver{}, want: "long polling"},
+		{name: "webhook without host", ar: &AutoReceiver{Webhook: &Webhook{Path: "/bot"}}, want: "long polling"},
+		{name: "webhook with host", ar: &AutoReceiver{Webhook: &Webhook{Host: "https://example.com"}}, want: "webhook"},
+		{name: "host from env", ar: &AutoReceiver{Webhook: &Webhook{Path: "/bot"}, HostEnv: "TEST_WEBHOOK_HOST"}, env: "https://example.com", want: "webhook"},
+		{name: "empty env", ar: &AutoReceiver{HostEnv: "TEST_WEBHOOK_HOST"}, want: "long polling"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_WEBHOOK_HOST", tt.env)
+
+			b := &Bot{Token: "1:token", Receiver: tt.ar}
+			b.init(context.Background())
+
+			switch r := b.Receiver.(type) {
+			case *Webhook:
+				assert.Equal(t, "webhook", tt.want)
+				assert.Equal(t, b, r.bot)
+			case *LongPolling:
+				assert.Equal(t, "long polling", tt.want)
+				assert.Equal(t, b, r.bot)
+			default:
+				t.Errorf("unexpected receiver %T", r)
+			}
+		})
+	}
+}
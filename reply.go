@@ -0,0 +1,314 @@
+package botify
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNoChat is returned by the reply helpers of [Context] when the update has no chat to reply to,
+// e.g. for inline queries.
+var ErrNoChat = errors.New("the update has no chat to reply to")
+
+// ErrNoMessage is returned by the helpers of [Context] working with the update's message,
+// when the update has no such message.
+var ErrNoMessage = errors.New("the update has no message")
+
+// replyTarget holds the parameters shared by every method sending a message into the update's chat
+type replyTarget struct {
+	ChatID               string
+	MessageThreadID      int
+	BusinessConnectionID string
+	ReplyParameters      *ReplyParameters
+}
+
+// replyTarget returns where to send a message in response to the update.
+// If quote is true and the update has its own message, the response will be a reply to it
+func (c *Context) replyTarget(quote bool) (replyTarget, error) {
+	chat := c.EffectiveChat()
+	if chat == nil {
+		return replyTarget{}, ErrNoChat
+	}
+
+	t := replyTarget{ChatID: strconv.FormatInt(chat.ID, 10)}
+
+	msg := c.EffectiveMessage()
+	if msg == nil {
+		return t, nil
+	}
+	if msg.IsTopicMessage != nil && *msg.IsTopicMessage && msg.MessageThreadId != nil {
+		t.MessageThreadID = *msg.MessageThreadId
+	}
+	if msg.BusinessConnectionId != nil {
+		t.BusinessConnectionID = *msg.BusinessConnectionId
+	}
+	// replying to the bot's own message with an inline keyboard makes no sense
+	if quote && c.upd.message() != nil {
+		allow := true
+		t.ReplyParameters = &ReplyParameters{
+			MessageId:                msg.MessageId,
+			AllowSendingWithoutReply: &allow,
+		}
+	}
+	return t, nil
+}
+
+// sendMessage sends obj and decodes the resulting [Message]
+func (c *Context) sendMessage(obj APIMethod) (*Message, error) {
+	resp, err := c.SendRequest(obj)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Ok && len(resp.Result) == 0 {
+		// sent in the response to the webhook request, see [Webhook.ReplyInResponse]
+		return nil, nil
+	}
+
+	var msg Message
+	if err = resp.BindResult(&msg); err != nil {
+		return nil, fmt.Errorf("reading %s result: %w", obj.APIEndpoint(), err)
+	}
+	return &msg, nil
+}
+
+// Reply sends a text message into the chat where the update has happened,
+// as a reply to the update's message.
+// Topic, business connection and reply parameters are filled automatically,
+// and can be changed by opts before sending.
+// It returns [ErrNoChat] if there's no chat to reply to.
+func (c *Context) Reply(text string, opts ...func(*SendMessage)) (*Message, error) {
+	return c.sendText(text, true, opts)
+}
+
+// Respond works just like [Context.Reply],
+// but sends a message without replying to the update's message.
+func (c *Context) Respond(text string, opts ...func(*SendMessage)) (*Message, error) {
+	return c.sendText(text, false, opts)
+}
+
+func (c *Context) sendText(text string, quote bool, opts []func(*SendMessage)) (*Message, error) {
+	t, err := c.replyTarget(quote)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendMessage{
+		ChatID:               t.ChatID,
+		Text:                 text,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyPhoto works just like [Context.Reply], but sends a photo.
+func (c *Context) ReplyPhoto(photo InputFile, opts ...func(*SendPhoto)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendPhoto{
+		ChatID:               t.ChatID,
+		Photo:                photo,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyAudio works just like [Context.Reply], but sends an audio.
+func (c *Context) ReplyAudio(audio InputFile, opts ...func(*SendAudio)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendAudio{
+		ChatID:               t.ChatID,
+		Audio:                audio,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyDocument works just like [Context.Reply], but sends a document.
+func (c *Context) ReplyDocument(document InputFile, opts ...func(*SendDocument)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendDocument{
+		ChatID:               t.ChatID,
+		Document:             document,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyVideo works just like [Context.Reply], but sends a video.
+func (c *Context) ReplyVideo(video InputFile, opts ...func(*SendVideo)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendVideo{
+		ChatID:               t.ChatID,
+		Video:                video,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyAnimation works just like [Context.Reply], but sends an animation.
+func (c *Context) ReplyAnimation(animation InputFile, opts ...func(*SendAnimation)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendAnimation{
+		ChatID:               t.ChatID,
+		Animation:            animation,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyVoice works just like [Context.Reply], but sends a voice message.
+func (c *Context) ReplyVoice(voice InputFile, opts ...func(*SendVoice)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendVoice{
+		ChatID:               t.ChatID,
+		Voice:                voice,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// ReplyVideoNote works just like [Context.Reply], but sends a video note.
+func (c *Context) ReplyVideoNote(note InputFile, opts ...func(*SendVideoNote)) (*Message, error) {
+	t, err := c.replyTarget(true)
+	if err != nil {
+		return nil, err
+	}
+
+	m := SendVideoNote{
+		ChatID:               t.ChatID,
+		VideoNote:            note,
+		MessageThreadID:      t.MessageThreadID,
+		BusinessConnectionID: t.BusinessConnectionID,
+		ReplyParameters:      t.ReplyParameters,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return c.sendMessage(&m)
+}
+
+// EditText edits the text of the update's message,
+// which for callback queries is the message with the pressed button.
+// Messages sent via the bot in inline mode are edited too,
+// but in that case the returned message is always nil.
+// It returns [ErrNoMessage] if there's nothing to edit.
+func (c *Context) EditText(text string, opts ...func(*EditMessageText)) (*Message, error) {
+	m := EditMessageText{Text: text}
+
+	cq := c.upd.CallbackQuery
+	if cq != nil && cq.InlineMessageId != nil {
+		m.InlineMessageID = *cq.InlineMessageId
+	} else {
+		msg := c.EffectiveMessage()
+		if msg == nil {
+			return nil, ErrNoMessage
+		}
+		m.ChatID = strconv.FormatInt(msg.Chat.ID, 10)
+		m.MessageID = msg.MessageId
+		if msg.BusinessConnectionId != nil {
+			m.BusinessConnectionID = *msg.BusinessConnectionId
+		}
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if m.InlineMessageID != "" {
+		_, err := c.SendRequest(&m)
+		return nil, err
+	}
+	return c.sendMessage(&m)
+}
+
+// Delete deletes the update's message,
+// which for callback queries is the message with the pressed button.
+// It returns [ErrNoMessage] if there's nothing to delete.
+func (c *Context) Delete() error {
+	msg := c.EffectiveMessage()
+	if msg == nil {
+		return ErrNoMessage
+	}
+
+	_, err := c.SendRequest(&DeleteMessage{
+		ChatID:    strconv.FormatInt(msg.Chat.ID, 10),
+		MessageID: msg.MessageId,
+	})
+	return err
+}
+
+// AnswerCallback answers the update's callback query with an optional text notification.
+// It returns an error if the update is not a callback query.
+func (c *Context) AnswerCallback(text string, opts ...func(*AnswerCallbackQuery)) error {
+	if c.upd.CallbackQuery == nil {
+		return fmt.Errorf("the update is not a callback query")
+	}
+
+	m := AnswerCallbackQuery{
+		CallbackQueryID: c.upd.CallbackQuery.Id,
+		Text:            text,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	_, err := c.SendRequest(&m)
+	return err
+}
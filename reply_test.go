@@ -0,0 +1,78 @@
+package botify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_Reply(t *testing.T) {
+	isTopic := true
+	threadID := 5
+	bizID := "biz"
+
+	testcases := []struct {
+		Name   string
+		Input  Update
+		Quote  bool
+		Output SendMessage
+		Err    error
+	}{
+		{
+			Name:   "reply in forum topic",
+			Input:  Update{Message: &Message{MessageId: 10, Chat: Chat{ID: -100}, IsTopicMessage: &isTopic, MessageThreadId: &threadID}},
+			Quote:  true,
+			Output: SendMessage{ChatID: "-100", Text: "hi", MessageThreadID: 5, ReplyParameters: &ReplyParameters{MessageId: 10}},
+		},
+		{
+			Name:   "respond to business message",
+			Input:  Update{BusinessMessage: &Message{MessageId: 10, Chat: Chat{ID: 1}, BusinessConnectionId: &bizID}},
+			Output: SendMessage{ChatID: "1", Text: "hi", BusinessConnectionID: "biz"},
+		},
+		{
+			Name:   "callback query is never quoted",
+			Input:  Update{CallbackQuery: &CallbackQuery{Message: &MaybeInaccessibleMessage{MessageId: 10, Chat: Chat{ID: 1}}}},
+			Quote:  true,
+			Output: SendMessage{ChatID: "1", Text: "hi"},
+		},
+		{
+			Name:  "no chat",
+			Input: Update{InlineQuery: &InlineQuery{}},
+			Err:   ErrNoChat,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			sender := &testSender{Result: []byte(`{"message_id":11,"date":0,"chat":{"id":1,"type":"private"}}`)}
+			ctx := Context{bot: &Bot{Sender: sender}, upd: &tc.Input, updType: tc.Input.UpdateType()}
+
+			var (
+				msg *Message
+				err error
+			)
+			if tc.Quote {
+				msg, err = ctx.Reply("hi")
+			} else {
+				msg, err = ctx.Respond("hi")
+			}
+
+			if tc.Err != nil {
+				assert.ErrorIs(t, err, tc.Err)
+				assert.Empty(t, sender.Sent())
+				return
+			}
+			if !assert.NoError(t, err) || !assert.Len(t, sender.Sent(), 1) {
+				t.FailNow()
+			}
+			assert.Equal(t, 11, msg.MessageId)
+
+			sent := sender.Sent()[0].(*SendMessage)
+			if tc.Output.ReplyParameters != nil && assert.NotNil(t, sent.ReplyParameters) {
+				assert.Equal(t, tc.Output.ReplyParameters.MessageId, sent.ReplyParameters.MessageId)
+				tc.Output.ReplyParameters = sent.ReplyParameters
+			}
+			assert.Equal(t, tc.Output, *sent)
+		})
+	}
+}
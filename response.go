@@ -0,0 +1,125 @@
+package botify
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/bigelle/botify/internal/reused"
+)
+
+// webhookResponse is the request to be sent in the response to the webhook request,
+// see [Webhook.ReplyInResponse]
+type webhookResponse struct {
+	// only the first request can be sent in the response
+	tried bool
+	body  []byte
+}
+
+// capture tries to turn the first request into the webhook response body.
+// It returns false if it's not the first request, if its result can be observed by the caller,
+// if it uploads files, or if it can't be sent as JSON.
+// The requests getting something from the API don't count as the first one,
+// since they change nothing and are always sent as usual
+func (r *webhookResponse) capture(endpoint string, obj any, payload func(io.Writer) (string, error)) bool {
+	if r.tried || strings.HasPrefix(endpoint, "get") {
+		return false
+	}
+	r.tried = true
+
+	if !isCapturable(endpoint) || carriesReader(reflect.ValueOf(obj), 0) {
+		return false
+	}
+
+	buf := reused.Buf()
+	defer reused.PutBuf(buf)
+
+	ct, err := payload(buf)
+	if err != nil {
+		// let the sender report it as usual
+		return false
+	}
+
+	fields := make(map[string]json.RawMessage)
+	switch {
+	case ct == "application/json":
+		if err = json.Unmarshal(buf.Bytes(), &fields); err != nil {
+			return false
+		}
+	case buf.Len() != 0:
+		return false
+	}
+
+	fields["method"], _ = json.Marshal(endpoint)
+	if r.body, err = json.Marshal(fields); err != nil {
+		return false
+	}
+	return true
+}
+
+// the requests whose result is rarely needed, so the unknown result is acceptable
+var capturablePrefixes = []string{"send", "forward", "copy", "edit", "delete", "answer"}
+
+func isCapturable(endpoint string) bool {
+	for _, prefix := range capturablePrefixes {
+		if strings.HasPrefix(endpoint, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var readerType = reflect.TypeFor[io.Reader]()
+
+// carriesReader reports whether v holds an [io.Reader], e.g. the data of [InputFileLocal],
+// which can be read only once, so v must not be serialized before it's sent
+func carriesReader(v reflect.Value, depth int) bool {
+	// the API objects are never nested deeper
+	if depth > 8 || !v.IsValid() {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return false
+		}
+		if v.Kind() == reflect.Pointer && v.Type().Implements(readerType) {
+			return true
+		}
+		return carriesReader(v.Elem(), depth+1)
+	case reflect.Struct:
+		if v.Type().Implements(readerType) {
+			return true
+		}
+		for i := range v.NumField() {
+			if carriesReader(v.Field(i), depth+1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		switch v.Type().Elem().Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Struct, reflect.Slice, reflect.Array:
+		default:
+			return false
+		}
+		for i := range v.Len() {
+			if carriesReader(v.Index(i), depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// captureResponse reports whether the request is sent in the response to the webhook request
+func (c *Context) captureResponse(endpoint string, obj any, payload func(io.Writer) (string, error)) bool {
+	return c.response != nil && c.response.capture(endpoint, obj, payload)
+}
+
+// respondedResult is what the handler gets for the request sent in the response to the webhook request.
+// Its result is unknown
+func respondedResult() *APIResponse {
+	return &APIResponse{Ok: true, Description: "sent in the response to the webhook request"}
+}
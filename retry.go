@@ -0,0 +1,71 @@
+package botify
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy decides if the failed request should be sent again, see [TGBotAPIRequestSender.RetryPolicy].
+// Implementations must be safe for concurrent use.
+type RetryPolicy interface {
+	// Retry is called after every failed attempt, starting from 1,
+	// with the response, if it was received, and the error.
+	// It returns the delay before the next attempt, or false if the request should not be sent again.
+	// It's not called if the context of the request is done.
+	Retry(attempt int, resp *APIResponse, err error) (delay time.Duration, ok bool)
+}
+
+// NoRetry is a [RetryPolicy] which never sends the request again.
+var NoRetry RetryPolicy = DefaultRetryPolicy{MaxAttempts: 1}
+
+// DefaultRetryPolicy sends the request again after the flood control error, waiting for "retry_after" seconds,
+// after Telegram server errors (5xx) and after network errors, waiting with exponential backoff.
+// Other errors, like invalid parameters, are never retried.
+//
+// Note that the network error may happen after the request was received by Telegram,
+// so the message may be sent twice. Use [NoRetry] if that's unacceptable.
+//
+// It is ready to use with its zero value.
+type DefaultRetryPolicy struct {
+	// The maximum number of attempts, including the first one.
+	// Defaults to 3
+	MaxAttempts int
+	// The delay before the first retry after a server or network error,
+	// doubled after every following failed attempt.
+	// Defaults to 500 milliseconds
+	MinBackoff time.Duration
+	// The maximum delay between the retries after a server or network error.
+	// Defaults to 10 seconds
+	MaxBackoff time.Duration
+}
+
+// Retry satisfies the RetryPolicy interface
+func (p DefaultRetryPolicy) Retry(attempt int, resp *APIResponse, err error) (time.Duration, bool) {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = 500 * time.Millisecond
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = max(10*time.Second, p.MinBackoff)
+	}
+
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	var errRateLimit TooManyRequestsError
+	if errors.As(err, &errRateLimit) {
+		return errRateLimit.RetryAfter(), true
+	}
+	if resp != nil && resp.ErrorCode >= 500 {
+		return backoff(attempt-1, p.MinBackoff, p.MaxBackoff), true
+	}
+	var errNetwork *url.Error
+	if resp == nil && errors.As(err, &errNetwork) {
+		return backoff(attempt-1, p.MinBackoff, p.MaxBackoff), true
+	}
+	return 0, false
+}
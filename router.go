@@ -0,0 +1,62 @@
+package botify
+
+// Router dispatches updates to the first handler whose filters all match the update.
+// Handlers are tried in the order they were registered.
+// If none of them matches, the fallback handler is used, if any.
+//
+// Router is ready to use with its zero value.
+// It can be used on its own as a regular [HandlerFunc] through [Router.Dispatch],
+// but in most cases you'll want to use [Bot.HandleFiltered] instead.
+type Router struct {
+	routes   []route
+	fallback HandlerFunc
+}
+
+type route struct {
+	filters []Filter
+	handler HandlerFunc
+}
+
+// Handle adds the handler which will be used only if every filter matches the update.
+// The handler with no filters matches any update.
+func (r *Router) Handle(handler HandlerFunc, filters ...Filter) *Router {
+	r.routes = append(r.routes, route{filters: filters, handler: handler})
+	return r
+}
+
+// Fallback sets the handler which will be used if no other handler matches the update.
+func (r *Router) Fallback(handler HandlerFunc) *Router {
+	r.fallback = handler
+	return r
+}
+
+// Dispatch calls the first matching handler.
+// It does nothing and returns nil if there is no matching handler and no fallback.
+func (r *Router) Dispatch(ctx *Context) error {
+	handler, ok := r.match(ctx)
+	if !ok {
+		return nil
+	}
+	return handler(ctx)
+}
+
+func (r *Router) match(ctx *Context) (HandlerFunc, bool) {
+	for _, rt := range r.routes {
+		if matchAll(ctx, rt.filters) {
+			return rt.handler, true
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback, true
+	}
+	return nil, false
+}
+
+func matchAll(ctx *Context, filters []Filter) bool {
+	for _, f := range filters {
+		if !f(ctx) {
+			return false
+		}
+	}
+	return true
+}
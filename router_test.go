@@ -0,0 +1,93 @@
+package botify
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_Dispatch(t *testing.T) {
+	var handled string
+	handler := func(name string) HandlerFunc {
+		return func(ctx *Context) error {
+			handled = name
+			return nil
+		}
+	}
+
+	r := new(Router).
+		Handle(handler("greeting"), ChatType(ChatTypePrivate), TextMatches(regexp.MustCompile(`^(hi|hello)`))).
+		Handle(handler("photo"), HasPhoto).
+		Handle(handler("not private"), Not(ChatType(ChatTypePrivate))).
+		Fallback(handler("fallback"))
+
+	testcases := []struct {
+		Name   string
+		Input  Message
+		Output string
+	}{
+		{
+			Name:   "greeting in private chat",
+			Input:  Message{Chat: Chat{ID: 1, Type: ChatTypePrivate}, Text: strPointer("hello there")},
+			Output: "greeting",
+		},
+		{
+			Name:   "photo in private chat",
+			Input:  Message{Chat: Chat{ID: 1, Type: ChatTypePrivate}, Photo: &[]PhotoSize{{}}},
+			Output: "photo",
+		},
+		{
+			Name:   "greeting in group chat",
+			Input:  Message{Chat: Chat{ID: -1, Type: ChatTypeGroup}, Text: strPointer("hi")},
+			Output: "not private",
+		},
+		{
+			Name:   "no match",
+			Input:  Message{Chat: Chat{ID: 1, Type: ChatTypePrivate}, Text: strPointer("bye")},
+			Output: "fallback",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			handled = ""
+			upd := Update{Message: &tc.Input}
+			ctx := Context{upd: &upd, updType: upd.UpdateType()}
+
+			assert.NoError(t, r.Dispatch(&ctx))
+			assert.Equal(t, tc.Output, handled)
+		})
+	}
+}
+
+func TestFilters(t *testing.T) {
+	b := &Bot{Token: "12345:secret"}
+	upd := Update{Message: &Message{
+		Chat:           Chat{ID: -100, Type: ChatTypeSupergroup},
+		From:           &User{ID: 42},
+		Text:           strPointer("thanks"),
+		ReplyToMessage: &Message{From: &User{ID: 12345, IsBot: true}},
+	}}
+	ctx := &Context{bot: b, upd: &upd, updType: upd.UpdateType()}
+
+	testcases := []struct {
+		Name   string
+		Filter Filter
+		Output bool
+	}{
+		{"chat ID allowed", ChatID(-100, -200), true},
+		{"chat ID not allowed", ChatID(-200), false},
+		{"from user", FromUser(42), true},
+		{"reply to bot", IsReplyToBot, true},
+		{"and", And(ChatType(ChatTypeSupergroup), FromUser(1)), false},
+		{"or", Or(ChatType(ChatTypeChannel), FromUser(42)), true},
+		{"no photo", HasPhoto, false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Output, tc.Filter(ctx))
+		})
+	}
+}
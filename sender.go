@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
@@ -51,6 +50,24 @@ func (e BadRequestError) Error() string {
 	return string(e)
 }
 
+// UnauthorizedError is an error signalizing that the API token is invalid or has been revoked,
+// so no request will ever succeed,
+// and holding a human readable error description as string
+type UnauthorizedError string
+
+func (e UnauthorizedError) Error() string {
+	return string(e)
+}
+
+// ConflictError is an error signalizing that the updates are already being received somewhere else:
+// by another bot instance with /getUpdates, or by the webhook,
+// and holding a human readable error description as string
+type ConflictError string
+
+func (e ConflictError) Error() string {
+	return string(e)
+}
+
 // APIResponse is a response from Telegram Bot API
 type APIResponse struct {
 	// True if success, false otherwise
@@ -96,6 +113,7 @@ func (r *APIResponse) IsSuccessful() bool {
 // GetError returns nil if the request was successfull,
 // ChatMigratedError if MigrateToChatId is not nil,
 // TooManyRequestsError if RetryAfter is not nil,
+// UnauthorizedError and ConflictError for the 401 and 409 error codes,
 // and BadRequestError with the error description if there's nothing more suitable
 func (r *APIResponse) GetError() error {
 	if r.IsSuccessful() {
@@ -112,7 +130,13 @@ func (r *APIResponse) GetError() error {
 		}
 	}
 
-	return fmt.Errorf("%d: %s", r.ErrorCode, BadRequestError(r.Description))
+	switch r.ErrorCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%d: %w", r.ErrorCode, UnauthorizedError(r.Description))
+	case http.StatusConflict:
+		return fmt.Errorf("%d: %w", r.ErrorCode, ConflictError(r.Description))
+	}
+	return fmt.Errorf("%d: %w", r.ErrorCode, BadRequestError(r.Description))
 }
 
 // ResponseParameters helps to automatically handle the error
@@ -129,6 +153,58 @@ type RequestSender interface {
 	SendJSONWithContext(ctx context.Context, method string, obj any) (*APIResponse, error)
 }
 
+// SendFunc sends the request to the Bot API method.
+// obj is either the [APIMethod] with the same endpoint, sent like with [RequestSender.SendWithContext],
+// or any other object, sent as JSON like with [RequestSender.SendJSONWithContext].
+type SendFunc func(ctx context.Context, method string, obj any) (*APIResponse, error)
+
+// SenderMiddleware wraps the SendFunc to do something before and/or after the request is sent,
+// e.g. to log it, collect metrics or cache the result. See [WrapSender].
+type SenderMiddleware func(next SendFunc) SendFunc
+
+// WrapSender returns a RequestSender which sends every request through the middleware with sender.
+// The first middleware is the outermost one,
+// so WrapSender(s, a, b) is equivalent to a(b(s)).
+func WrapSender(sender RequestSender, middleware ...SenderMiddleware) RequestSender {
+	var send SendFunc = func(ctx context.Context, method string, obj any) (*APIResponse, error) {
+		if m, ok := obj.(APIMethod); ok && m.APIEndpoint() == method {
+			return sender.SendWithContext(ctx, m)
+		}
+		return sender.SendJSONWithContext(ctx, method, obj)
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		send = middleware[i](send)
+	}
+	return &wrappedSender{send: send}
+}
+
+// wrappedSender implements every method of RequestSender with a single SendFunc
+type wrappedSender struct {
+	send SendFunc
+}
+
+func (s *wrappedSender) Send(obj APIMethod) (*APIResponse, error) {
+	return s.SendWithContext(context.Background(), obj)
+}
+
+func (s *wrappedSender) SendWithContext(ctx context.Context, obj APIMethod) (*APIResponse, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("obj can't be empty")
+	}
+	return s.send(ctx, obj.APIEndpoint(), obj)
+}
+
+func (s *wrappedSender) SendJSON(method string, obj any) (*APIResponse, error) {
+	return s.SendJSONWithContext(context.Background(), method, obj)
+}
+
+func (s *wrappedSender) SendJSONWithContext(ctx context.Context, method string, obj any) (*APIResponse, error) {
+	if method == "" {
+		return nil, fmt.Errorf("method can't be empty")
+	}
+	return s.send(ctx, method, obj)
+}
+
 // JSON is an alias for map[string]any
 type JSON map[string]any
 
@@ -136,10 +212,11 @@ type JSON map[string]any
 // Every method returns [APIResponse] and the result of APIResponse.GetError(), no matter if it's successful or not.
 // So there's no need to manually check for `if resp.GetError() != nil` after every request.
 //
-// If the request fails and if the response parameters contains a "retry_after" field,
-// it will try to send the request one more time after n seconds, where n is the value of the "retry_after" field
+// If the request fails, it may be sent again according to [TGBotAPIRequestSender.RetryPolicy]
 type TGBotAPIRequestSender struct {
 	// HTTP Client used to send requests.
+	// If it has no Timeout, every attempt to send the request is given 30 seconds,
+	// and /getUpdates is also given the time to wait for the updates, see [GetUpdates.Timeout].
 	// Defaults to a client optimised for keeping connection alive
 	Client *http.Client
 	// Telegram Bot API token.
@@ -148,6 +225,9 @@ type TGBotAPIRequestSender struct {
 	// In format `https://example.com`.
 	// Defaults to [TelegramBotAPIHost]
 	APIHost string
+	// Decides if the failed request is sent again.
+	// Defaults to [DefaultRetryPolicy], use [NoRetry] to disable retries
+	RetryPolicy RetryPolicy
 }
 
 // Send satisfies RequestSender interface.
@@ -158,8 +238,7 @@ func (s *TGBotAPIRequestSender) Send(obj APIMethod) (apiResp *APIResponse, err e
 
 // SendWithContext satisfies RequestSender interface.
 //
-// If the request fails and if the response parameters contains a "retry_after" field,
-// it will try to send the request one more time after n seconds, where n is the value of the "retry_after" field
+// If the request fails, it may be sent again according to the RetryPolicy
 func (s *TGBotAPIRequestSender) SendWithContext(ctx context.Context, obj APIMethod) (apiResp *APIResponse, err error) {
 	if obj == nil {
 		return nil, fmt.Errorf("obj can't be empty")
@@ -173,68 +252,113 @@ func (s *TGBotAPIRequestSender) SendWithContext(ctx context.Context, obj APIMeth
 	if err != nil {
 		return nil, fmt.Errorf("forming request payload: %w", err)
 	}
-	return s.send(ctx, obj.APIEndpoint(), buf, ct)
+	return s.send(ctx, obj.APIEndpoint(), buf.Bytes(), ct, requestTimeout(obj))
 }
 
 // SendJSON satisfies RequestSender interface
 // It's a wrapper for [SendJSONWithContext] that uses [context.Background] as ctx.
 //
-// If the request fails and if the response parameters contains a "retry_after" field,
-// it will try to send the request one more time after n seconds, where n is the value of the "retry_after" field
+// If the request fails, it may be sent again according to the RetryPolicy
 func (s *TGBotAPIRequestSender) SendJSON(method string, obj any) (apiResp *APIResponse, err error) {
 	return s.SendJSONWithContext(context.Background(), method, obj)
 }
 
 // SendJSONWithContext satisfies RequestSender interface
 //
-// If the request fails and if the response parameters contains a "retry_after" field,
-// it will try to send the request one more time after n seconds, where n is the value of the "retry_after" field
+// If the request fails, it may be sent again according to the RetryPolicy
 func (s *TGBotAPIRequestSender) SendJSONWithContext(ctx context.Context, method string, obj any) (apiResp *APIResponse, err error) {
 	if method == "" {
 		return nil, fmt.Errorf("method can't be empty")
 	}
 
-	var payload *bytes.Buffer
+	var payload []byte
 	if obj != nil {
-		payload = reused.Buf()
-		defer reused.PutBuf(payload)
+		buf := reused.Buf()
+		defer reused.PutBuf(buf)
 
-		if err = json.NewEncoder(payload).Encode(obj); err != nil {
+		if err = json.NewEncoder(buf).Encode(obj); err != nil {
 			return nil, fmt.Errorf("encoding request payload: %w", err)
 		}
+		payload = buf.Bytes()
+	}
+	return s.send(ctx, method, payload, "application/json", requestTimeout(obj))
+}
+
+// defaultRequestTimeout is the time given to every attempt to send the request,
+// unless the client has a timeout of its own
+var defaultRequestTimeout = 30 * time.Second
+
+// requestTimeout returns the time given to the request,
+// so the long polling requests don't expire while Telegram is waiting for the updates
+func requestTimeout(obj any) time.Duration {
+	switch m := obj.(type) {
+	case *GetUpdates:
+		return defaultRequestTimeout + time.Duration(m.Timeout)*time.Second
+	case GetUpdates:
+		return defaultRequestTimeout + time.Duration(m.Timeout)*time.Second
 	}
-	return s.send(ctx, method, payload, "application/json")
+	return defaultRequestTimeout
 }
 
-func (s *TGBotAPIRequestSender) send(ctx context.Context, method string, payload io.Reader, contentType string) (apiResp *APIResponse, err error) {
+// defaultClient returns the client optimised for keeping connection alive.
+// It has no timeout, so the time given to the request depends on the request, see [requestTimeout]
+func defaultClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     90 * time.Second,
+			DisableKeepAlives:   false,
+		},
+	}
+}
+
+func (s *TGBotAPIRequestSender) send(ctx context.Context, method string, payload []byte, contentType string, timeout time.Duration) (apiResp *APIResponse, err error) {
 	if s.APIToken == "" {
 		panic("API Token is empty")
 	}
 	if s.Client == nil {
-		s.Client = &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 100,
-				IdleConnTimeout:     90 * time.Second,
-				DisableKeepAlives:   false,
-			},
-		}
+		s.Client = defaultClient()
 	}
 	if s.APIHost == "" {
 		s.APIHost = TelegramBotAPIHost
 	}
+	if s.RetryPolicy == nil {
+		s.RetryPolicy = DefaultRetryPolicy{}
+	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
-	var req *http.Request
-	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		apiResp, err = s.sendOnce(ctx, method, payload, contentType, timeout)
+		if err == nil || ctx.Err() != nil {
+			return apiResp, err
+		}
+
+		delay, ok := s.RetryPolicy.Retry(attempt, apiResp, err)
+		if !ok {
+			return apiResp, err
+		}
+		if !sleepContext(ctx, delay) {
+			return apiResp, fmt.Errorf("%w; not retried: %w", err, ctx.Err())
+		}
+	}
+}
+
+// sendOnce sends the request with a fresh body, so it can be called again with the same payload.
+// The timeout is used only if the client has none
+func (s *TGBotAPIRequestSender) sendOnce(ctx context.Context, method string, payload []byte, contentType string, timeout time.Duration) (*APIResponse, error) {
+	if s.Client.Timeout == 0 && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	reqURL := fmt.Sprintf("%s/bot%s/%s", s.APIHost, s.APIToken, method)
 	forDebugURL := fmt.Sprintf("%s/bot<API token with length = %d>/%s", s.APIHost, len(s.APIToken), method)
 
-	req, err = http.NewRequestWithContext(ctx, "POST", reqURL, payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(payload))
 	if err != nil {
 		return nil, fmt.Errorf("creating request with URL %s: %w", forDebugURL, err)
 	}
@@ -242,27 +366,20 @@ func (s *TGBotAPIRequestSender) send(ctx context.Context, method string, payload
 		req.Header.Add("Content-Type", contentType)
 	}
 
-	sendRequest := func(req *http.Request) (*APIResponse, error) {
-		resp, err = s.Client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("sending request with URL %s: %w", forDebugURL, err)
-		}
-		defer resp.Body.Close()
-
-		if err = json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-			return nil, fmt.Errorf("reading API response: %w", err)
-		}
-		return apiResp, apiResp.GetError()
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request with URL %s: %w", forDebugURL, err)
 	}
-
-	var errRateLimit TooManyRequestsError
-
-	apiResp, err = sendRequest(req)
-	if err != nil && errors.As(err, &errRateLimit) {
-		// trying one more time after a quick nap
-		time.Sleep(errRateLimit.RetryAfter())
-
-		apiResp, err = sendRequest(req)
+	defer resp.Body.Close()
+
+	var apiResp APIResponse
+	if err = json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		if resp.StatusCode >= 500 {
+			// e.g. a proxy in front of the Bot API server responding with HTML
+			apiResp = APIResponse{Ok: false, ErrorCode: resp.StatusCode, Description: resp.Status}
+			return &apiResp, apiResp.GetError()
+		}
+		return nil, fmt.Errorf("reading API response: %w", err)
 	}
-	return apiResp, err
+	return &apiResp, apiResp.GetError()
 }
@@ -0,0 +1,218 @@
+package botify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type scriptedReply struct {
+	code int
+	body string
+}
+
+// scriptedServer responds to the requests in the given order, and with the last response once the script is over
+type scriptedServer struct {
+	script []scriptedReply
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := min(len(s.bodies), len(s.script)-1)
+	s.bodies = append(s.bodies, string(body))
+
+	w.WriteHeader(s.script[i].code)
+	w.Write([]byte(s.script[i].body))
+}
+
+func TestTGBotAPIRequestSender_Retry(t *testing.T) {
+	const (
+		ok         = `{"ok":true,"result":true}`
+		flood      = `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":0}}`
+		serverErr  = `{"ok":false,"error_code":500,"description":"Internal Server Error"}`
+		badRequest = `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`
+	)
+	policy := DefaultRetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		script       []scriptedReply
+		obj          APIMethod
+		policy       RetryPolicy
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "flood control",
+			script:       []scriptedReply{{429, flood}, {200, ok}},
+			obj:          &SendMessage{ChatID: "1", Text: "hi"},
+			policy:       policy,
+			wantAttempts: 2,
+		},
+		{
+			name:         "server errors with multipart body",
+			script:       []scriptedReply{{500, serverErr}, {502, "<html>Bad Gateway</html>"}, {200, ok}},
+			obj:          &SendPhoto{ChatID: "1", Photo: InputFileLocal{Name: "photo.jpg", Data: strings.NewReader("photo")}},
+			policy:       policy,
+			wantAttempts: 3,
+		},
+		{
+			name:         "max attempts",
+			script:       []scriptedReply{{500, serverErr}},
+			obj:          &SendMessage{ChatID: "1", Text: "hi"},
+			policy:       policy,
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "bad request is not retried",
+			script:       []scriptedReply{{400, badRequest}},
+			obj:          &SendMessage{ChatID: "1", Text: "hi"},
+			policy:       policy,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "no retry",
+			script:       []scriptedReply{{429, flood}, {200, ok}},
+			obj:          &SendMessage{ChatID: "1", Text: "hi"},
+			policy:       NoRetry,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &scriptedServer{script: tt.script}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			s := &TGBotAPIRequestSender{APIToken: "1:token", APIHost: ts.URL, RetryPolicy: tt.policy}
+			_, err := s.SendWithContext(context.Background(), tt.obj)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if assert.Len(t, server.bodies, tt.wantAttempts) {
+				assert.NotEmpty(t, server.bodies[0])
+				for _, body := range server.bodies[1:] {
+					assert.Equal(t, server.bodies[0], body, "the same body is sent on every attempt")
+				}
+			}
+		})
+	}
+}
+
+func TestTGBotAPIRequestSender_RetryCancelled(t *testing.T) {
+	server := &scriptedServer{script: []scriptedReply{
+		{429, `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":60}}`},
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	s := &TGBotAPIRequestSender{APIToken: "1:token", APIHost: ts.URL}
+	_, err := s.SendWithContext(ctx, &SendMessage{ChatID: "1", Text: "hi"})
+
+	var errRateLimit TooManyRequestsError
+	assert.ErrorAs(t, err, &errRateLimit)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, server.bodies, 1)
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	retryAfter := 5
+	networkErr := &url.Error{Op: "Post", URL: "https://api.telegram.org", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name      string
+		attempt   int
+		resp      *APIResponse
+		err       error
+		wantOk    bool
+		wantDelay time.Duration
+	}{
+		{
+			name:      "flood control",
+			attempt:   1,
+			resp:      &APIResponse{ErrorCode: 429, Parameters: &ResponseParameters{RetryAfter: &retryAfter}},
+			err:       TooManyRequestsError(5),
+			wantOk:    true,
+			wantDelay: 5 * time.Second,
+		},
+		{name: "server error", attempt: 2, resp: &APIResponse{ErrorCode: 503}, err: BadRequestError("Service Unavailable"), wantOk: true},
+		{name: "network error", attempt: 1, err: networkErr, wantOk: true},
+		{name: "bad request", attempt: 1, resp: &APIResponse{ErrorCode: 400}, err: BadRequestError("Bad Request")},
+		{name: "unauthorized", attempt: 1, resp: &APIResponse{ErrorCode: 401}, err: UnauthorizedError("Unauthorized")},
+		{name: "decoding error", attempt: 1, err: errors.New("reading API response")},
+		{name: "max attempts", attempt: 3, err: networkErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := DefaultRetryPolicy{}.Retry(tt.attempt, tt.resp, tt.err)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantDelay != 0 {
+				assert.Equal(t, tt.wantDelay, delay)
+			}
+			if ok {
+				assert.LessOrEqual(t, delay, max(tt.wantDelay, 10*time.Second))
+			}
+		})
+	}
+}
+
+func TestWrapSender(t *testing.T) {
+	var calls []string
+	record := func(name string) SenderMiddleware {
+		return func(next SendFunc) SendFunc {
+			return func(ctx context.Context, method string, obj any) (*APIResponse, error) {
+				calls = append(calls, name+":"+method)
+				return next(ctx, method, obj)
+			}
+		}
+	}
+
+	base := &testSender{}
+	s := WrapSender(base, record("outer"), record("inner"))
+
+	_, err := s.Send(&SendMessage{ChatID: "1", Text: "hi"})
+	assert.NoError(t, err)
+	_, err = s.SendJSON("sendDice", JSON{"chat_id": 1})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"outer:sendMessage", "inner:sendMessage", "outer:sendDice", "inner:sendDice"}, calls)
+	// JSON requests are sent with SendJSONWithContext, which the test sender doesn't record
+	assert.Len(t, base.Sent(), 1)
+
+	// the middleware may stop the request
+	cached := WrapSender(base, func(next SendFunc) SendFunc {
+		return func(ctx context.Context, method string, obj any) (*APIResponse, error) {
+			return &APIResponse{Ok: true, Result: []byte(`"cached"`)}, nil
+		}
+	})
+	resp, err := cached.Send(&SendMessage{ChatID: "1", Text: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, `"cached"`, string(resp.Result))
+	assert.Len(t, base.Sent(), 1)
+}
@@ -0,0 +1,381 @@
+package botify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bigelle/botify/internal/jsonfile"
+)
+
+var (
+	// ErrSessionNotFound is returned by [SessionStore.Load] if there's no session for the given key.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionConflict is returned by [SessionStore.Save] if the session was modified
+	// after it had been loaded, e.g. by another worker handling an update from the same user.
+	ErrSessionConflict = errors.New("session was modified concurrently")
+)
+
+// SessionStore is used to keep session data between updates.
+// Every saved session has a version, which is used for optimistic concurrency control:
+// the session is saved only if it wasn't modified since it had been loaded.
+// Implementations must be safe for concurrent use
+// and must never return expired sessions.
+type SessionStore interface {
+	// Load returns the JSON-encoded session data and its version.
+	// It returns [ErrSessionNotFound] if there's no session for the key.
+	Load(ctx context.Context, key string) (data []byte, version int64, err error)
+	// Save replaces the session data if its current version is equal to version,
+	// which is zero for the new sessions, and returns the new version.
+	// It returns [ErrSessionConflict] if the versions don't match.
+	// The session expires after ttl, zero ttl means it never expires.
+	Save(ctx context.Context, key string, data []byte, version int64, ttl time.Duration) (int64, error)
+	// Delete removes the session, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// SessionScope defines whom the session belongs to.
+type SessionScope int
+
+const (
+	// SessionPerChatUser means every user has a separate session in every chat.
+	SessionPerChatUser SessionScope = iota
+	// SessionPerUser means every user has the same session in every chat.
+	SessionPerUser
+	// SessionPerChat means every user in the chat shares the same session.
+	SessionPerChat
+)
+
+// key returns the session key of the update, or false if the update doesn't belong to the scope
+func (s SessionScope) key(upd *Update) (string, bool) {
+	chat := upd.EffectiveChat()
+	user := upd.EffectiveUser()
+
+	switch s {
+	case SessionPerUser:
+		if user != nil {
+			return fmt.Sprintf("user:%d", user.ID), true
+		}
+	case SessionPerChat:
+		if chat != nil {
+			return fmt.Sprintf("chat:%d", chat.ID), true
+		}
+	default:
+		if chat != nil && user != nil {
+			return fmt.Sprintf("chat:%d:user:%d", chat.ID, user.ID), true
+		}
+	}
+	return "", false
+}
+
+// Session holds the typed session data of the update, see [Sessions].
+type Session[T any] struct {
+	// Data is saved after the handler returns, if it was changed.
+	Data T
+
+	key     string
+	version int64
+	orig    []byte
+	deleted bool
+}
+
+// Key returns the key the session is stored with.
+func (s *Session[T]) Key() string {
+	return s.key
+}
+
+// Delete resets the data and removes the session from the store after the handler returns.
+func (s *Session[T]) Delete() {
+	var zero T
+	s.Data = zero
+	s.deleted = true
+}
+
+// SessionOptions configures the middleware created with [Sessions].
+type SessionOptions[T any] struct {
+	// Where the sessions are kept. Defaults to a new [MemorySessionStore].
+	Store SessionStore
+	// Whom the session belongs to. Defaults to [SessionPerChatUser].
+	Scope SessionScope
+	// How long the session is kept since it was changed for the last time.
+	// Zero value means it never expires.
+	TTL time.Duration
+	// Returns the data of the new sessions. If nil, the zero value of T is used.
+	Init func() T
+}
+
+// sessionKey is the key of the [Session] in [Context]
+type sessionKey[T any] struct{}
+
+// Sessions returns a middleware which loads the session of the update before the handler,
+// makes it available with [GetSession] and saves it after the handler if the data was changed.
+// Updates which don't belong to the scope, e.g. inline queries for [SessionPerChat], have no session.
+// The session is not saved if the handler returns an error.
+// If the session was changed by another handler in the meantime,
+// the changes are dropped and the error wrapping [ErrSessionConflict] is returned.
+//
+// The data is stored encoded as JSON, so T must be JSON-serializable.
+// Different types of data may be used with the same store only if the scopes are different.
+func Sessions[T any](opts SessionOptions[T]) Middleware {
+	if opts.Store == nil {
+		opts.Store = &MemorySessionStore{}
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) error {
+			key, ok := opts.Scope.key(ctx.upd)
+			if !ok {
+				return next(ctx)
+			}
+
+			sess, err := loadSession(ctx.Context(), opts, key)
+			if err != nil {
+				return err
+			}
+			ctx.SetValue(sessionKey[T]{}, sess)
+
+			if err = next(ctx); err != nil {
+				return err
+			}
+			return saveSession(ctx.Context(), opts, sess)
+		}
+	}
+}
+
+func loadSession[T any](ctx context.Context, opts SessionOptions[T], key string) (*Session[T], error) {
+	sess := &Session[T]{key: key}
+
+	data, version, err := opts.Store.Load(ctx, key)
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		if opts.Init != nil {
+			sess.Data = opts.Init()
+		}
+		if data, err = json.Marshal(sess.Data); err != nil {
+			return nil, fmt.Errorf("encoding session data: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("loading session: %w", err)
+	default:
+		if err = json.Unmarshal(data, &sess.Data); err != nil {
+			return nil, fmt.Errorf("decoding session data: %w", err)
+		}
+	}
+
+	sess.version, sess.orig = version, data
+	return sess, nil
+}
+
+func saveSession[T any](ctx context.Context, opts SessionOptions[T], sess *Session[T]) error {
+	if sess.deleted {
+		if sess.version == 0 {
+			return nil
+		}
+		if err := opts.Store.Delete(ctx, sess.key); err != nil {
+			return fmt.Errorf("removing session: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(sess.Data)
+	if err != nil {
+		return fmt.Errorf("encoding session data: %w", err)
+	}
+	if bytes.Equal(data, sess.orig) {
+		return nil
+	}
+
+	version, err := opts.Store.Save(ctx, sess.key, data, sess.version, opts.TTL)
+	if err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+	sess.version, sess.orig = version, data
+	return nil
+}
+
+// GetSession returns the session loaded by the [Sessions] middleware with the same type of data,
+// or nil if there's none.
+func GetSession[T any](ctx *Context) *Session[T] {
+	sess, _ := ctx.Value(sessionKey[T]{}).(*Session[T])
+	return sess
+}
+
+type sessionEntry struct {
+	Data      json.RawMessage `json:"data"`
+	Version   int64           `json:"version"`
+	ExpiresAt time.Time       `json:"expires_at,omitzero"`
+}
+
+func (e sessionEntry) isExpired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// how often the expired sessions are evicted
+const sessionSweepInterval = time.Minute
+
+// sessionEntries is the part shared by the session stores, it must be guarded by the caller
+type sessionEntries struct {
+	m         map[string]sessionEntry
+	lastSweep time.Time
+}
+
+func (e *sessionEntries) load(key string) ([]byte, int64, error) {
+	ent, ok := e.m[key]
+	if !ok || ent.isExpired(time.Now()) {
+		return nil, 0, ErrSessionNotFound
+	}
+	return ent.Data, ent.Version, nil
+}
+
+func (e *sessionEntries) save(key string, data []byte, version int64, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	if e.m == nil {
+		e.m = make(map[string]sessionEntry)
+	}
+
+	var current int64
+	if ent, ok := e.m[key]; ok && !ent.isExpired(now) {
+		current = ent.Version
+	}
+	if current != version {
+		return 0, ErrSessionConflict
+	}
+
+	ent := sessionEntry{Data: data, Version: version + 1}
+	if ttl > 0 {
+		ent.ExpiresAt = now.Add(ttl)
+	}
+	e.m[key] = ent
+
+	e.sweep(now)
+	return ent.Version, nil
+}
+
+// sweep evicts the expired sessions, but not more often than once in sessionSweepInterval
+func (e *sessionEntries) sweep(now time.Time) {
+	if now.Sub(e.lastSweep) < sessionSweepInterval {
+		return
+	}
+	e.lastSweep = now
+
+	for key, ent := range e.m {
+		if ent.isExpired(now) {
+			delete(e.m, key)
+		}
+	}
+}
+
+// MemorySessionStore is an in-memory implementation of [SessionStore].
+// Every session is lost when the program exits.
+// It is ready to use with its zero value.
+type MemorySessionStore struct {
+	mu      sync.Mutex
+	entries sessionEntries
+}
+
+// Load satisfies the SessionStore interface
+func (s *MemorySessionStore) Load(_ context.Context, key string) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.entries.load(key)
+}
+
+// Save satisfies the SessionStore interface
+func (s *MemorySessionStore) Save(_ context.Context, key string, data []byte, version int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.entries.save(key, data, version, ttl)
+}
+
+// Delete satisfies the SessionStore interface
+func (s *MemorySessionStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries.m, key)
+	return nil
+}
+
+// FileSessionStore is an implementation of [SessionStore],
+// which keeps every session in memory and saves them into the local JSON file on every change,
+// so they survive restarts.
+// The file is read once, on the first use.
+// It is not meant to be shared between several running programs.
+type FileSessionStore struct {
+	// Path to the file. It will be created if it doesn't exist.
+	Path string
+
+	mu      sync.Mutex
+	loaded  bool
+	entries sessionEntries
+}
+
+// Load satisfies the SessionStore interface
+func (s *FileSessionStore) Load(_ context.Context, key string) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, 0, err
+	}
+	return s.entries.load(key)
+}
+
+// Save satisfies the SessionStore interface
+func (s *FileSessionStore) Save(_ context.Context, key string, data []byte, version int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	v, err := s.entries.save(key, data, version, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return v, s.flush()
+}
+
+// Delete satisfies the SessionStore interface
+func (s *FileSessionStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.entries.m[key]; !ok {
+		return nil
+	}
+	delete(s.entries.m, key)
+	return s.flush()
+}
+
+func (s *FileSessionStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.Path == "" {
+		return fmt.Errorf("session store file path is empty")
+	}
+
+	s.entries.m = make(map[string]sessionEntry)
+	if err := jsonfile.Read(s.Path, &s.entries.m); err != nil {
+		return fmt.Errorf("loading sessions: %w", err)
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *FileSessionStore) flush() error {
+	if err := jsonfile.Write(s.Path, s.entries.m); err != nil {
+		return fmt.Errorf("saving sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package botify
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionStores(t *testing.T) {
+	tests := []struct {
+		name  string
+		store SessionStore
+	}{
+		{name: "memory", store: &MemorySessionStore{}},
+		{name: "file", store: &FileSessionStore{Path: filepath.Join(t.TempDir(), "sessions.json")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, _, err := tt.store.Load(ctx, "user:1")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+
+			v, err := tt.store.Save(ctx, "user:1", []byte(`{"n":1}`), 0, 0)
+			assert.NoError(t, err)
+
+			// someone else has loaded the same version and saved it first
+			_, err = tt.store.Save(ctx, "user:1", []byte(`{"n":2}`), v, 0)
+			assert.NoError(t, err)
+			_, err = tt.store.Save(ctx, "user:1", []byte(`{"n":3}`), v, 0)
+			assert.ErrorIs(t, err, ErrSessionConflict)
+
+			data, _, err := tt.store.Load(ctx, "user:1")
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"n":2}`, string(data))
+
+			_, err = tt.store.Save(ctx, "user:2", []byte(`{}`), 0, -time.Second)
+			assert.NoError(t, err)
+			_, _, err = tt.store.Load(ctx, "user:2")
+			assert.NoError(t, err, "non-positive ttl means no expiration")
+
+			_, err = tt.store.Save(ctx, "user:3", []byte(`{}`), 0, time.Nanosecond)
+			assert.NoError(t, err)
+			time.Sleep(time.Millisecond)
+			_, _, err = tt.store.Load(ctx, "user:3")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+
+			assert.NoError(t, tt.store.Delete(ctx, "user:1"))
+			_, _, err = tt.store.Load(ctx, "user:1")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+		})
+	}
+}
+
+func TestFileSessionStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	s := &FileSessionStore{Path: path}
+	v, err := s.Save(context.Background(), "chat:1", []byte(`{"lang":"en"}`), 0, time.Hour)
+	assert.NoError(t, err)
+
+	// reading from the same file as if the program was restarted
+	s = &FileSessionStore{Path: path}
+	data, version, err := s.Load(context.Background(), "chat:1")
+	assert.NoError(t, err)
+	assert.Equal(t, v, version)
+	assert.JSONEq(t, `{"lang":"en"}`, string(data))
+}
+
+func TestSessions(t *testing.T) {
+	type counter struct {
+		Count int `json:"count"`
+	}
+	store := &MemorySessionStore{}
+	mw := Sessions(SessionOptions[counter]{Store: store, Scope: SessionPerUser})
+
+	h := WrapHandler(func(ctx *Context) error {
+		sess := GetSession[counter](ctx)
+		sess.Data.Count++
+		return nil
+	}, mw)
+
+	for range 3 {
+		upd := Update{Message: &Message{Chat: Chat{ID: 10}, From: &User{ID: 1}}}
+		ctx := Context{upd: &upd, ctx: context.Background()}
+		assert.NoError(t, h(&ctx))
+	}
+
+	data, version, err := store.Load(context.Background(), "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+	assert.JSONEq(t, `{"count":3}`, string(data))
+
+	// no changes, nothing to save
+	noop := WrapHandler(func(ctx *Context) error { return nil }, mw)
+	upd := Update{Message: &Message{Chat: Chat{ID: 10}, From: &User{ID: 1}}}
+	assert.NoError(t, noop(&Context{upd: &upd, ctx: context.Background()}))
+	_, version, _ = store.Load(context.Background(), "user:1")
+	assert.Equal(t, int64(3), version)
+
+	// the session was changed while the handler was running
+	racy := WrapHandler(func(ctx *Context) error {
+		GetSession[counter](ctx).Data.Count = 100
+		_, err := store.Save(context.Background(), "user:1", []byte(`{"count":4}`), 3, 0)
+		return err
+	}, mw)
+	assert.ErrorIs(t, racy(&Context{upd: &upd, ctx: context.Background()}), ErrSessionConflict)
+}
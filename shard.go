@@ -0,0 +1,103 @@
+package botify
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// ShardFunc returns the key of the update used to distribute updates between workers,
+// see [Bot.ShardBy].
+// Updates with no key, e.g. inline queries for [ShardByChat], are distributed evenly.
+type ShardFunc func(upd *Update) (key string, ok bool)
+
+// ShardByChat processes the updates from the same chat sequentially.
+// See [Update.EffectiveChat].
+func ShardByChat(upd *Update) (string, bool) {
+	chat := upd.EffectiveChat()
+	if chat == nil {
+		return "", false
+	}
+	return strconv.FormatInt(chat.ID, 10), true
+}
+
+// ShardByUser processes the updates caused by the same user sequentially,
+// no matter in which chat.
+// See [Update.EffectiveUser].
+func ShardByUser(upd *Update) (string, bool) {
+	user := upd.EffectiveUser()
+	if user == nil {
+		return "", false
+	}
+	return strconv.Itoa(user.ID), true
+}
+
+// shard returns the index of the worker the update with the given key is assigned to
+func shard(key string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// dispatch distributes updates from b.chUpdate between the workers' channels,
+// so the updates with the same key always go to the same worker.
+// Once the channel of a busy worker is full, it waits, so the receiver is slowed down too
+func (b *Bot) dispatch(workers []chan Update) {
+	defer func() {
+		for _, ch := range workers {
+			close(ch)
+		}
+	}()
+
+	next := 0
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+
+		case upd, ok := <-b.chUpdate:
+			if !ok {
+				return
+			}
+
+			var i int
+			if key, ok := b.ShardBy(&upd); ok {
+				i = shard(key, len(workers))
+			} else {
+				i = next
+				next = (next + 1) % len(workers)
+			}
+
+			select {
+			case workers[i] <- upd:
+			case <-b.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// startWorkers launches the worker pool.
+// If [Bot.ShardBy] is set, every worker gets its own channel
+func (b *Bot) startWorkers(lc *lifecycle) {
+	lc.workers.Add(b.WorkerPool)
+
+	if b.ShardBy == nil {
+		for range b.WorkerPool {
+			go b.work(b.chUpdate, &lc.workers)
+		}
+		return
+	}
+
+	workers := make([]chan Update, b.WorkerPool)
+	for i := range workers {
+		workers[i] = make(chan Update, shardQueueSize(b.ChanSize))
+		go b.work(workers[i], &lc.workers)
+	}
+	go b.dispatch(workers)
+}
+
+// shardQueueSize returns the number of updates waiting for the busy worker,
+// so the next update from the same chat doesn't hold up the updates for the other workers
+func shardQueueSize(chanSize int) int {
+	return max(chanSize, 1)
+}
@@ -0,0 +1,151 @@
+package botify
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardByChat(t *testing.T) {
+	tests := []struct {
+		name    string
+		upd     Update
+		wantKey string
+		wantOk  bool
+	}{
+		{name: "message", upd: Update{Message: &Message{Chat: Chat{ID: -100}}}, wantKey: "-100", wantOk: true},
+		{name: "inline query", upd: Update{InlineQuery: &InlineQuery{}}, wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := ShardByChat(&tt.upd)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantKey, key)
+		})
+	}
+}
+
+func TestBot_ShardedWorkers(t *testing.T) {
+	const (
+		chats    = 4
+		perChat  = 50
+		expected = chats * perChat
+	)
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[int64][]int)
+		wg   sync.WaitGroup
+	)
+	wg.Add(expected)
+
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Logger: logr.Discard(), WorkerPool: 3, ShardBy: ShardByChat}
+	b.Handle(UpdateTypeMessage, func(ctx *Context) error {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		msg := ctx.MustGetMessage()
+		seen[msg.Chat.ID] = append(seen[msg.Chat.ID], msg.MessageId)
+		return nil
+	})
+	b.init(context.Background())
+	b.startWorkers(&lifecycle{})
+	defer b.cancel()
+
+	for i := range perChat {
+		for chat := range chats {
+			b.chUpdate <- Update{Message: &Message{MessageId: i, Chat: Chat{ID: int64(chat)}}}
+		}
+	}
+	wg.Wait()
+
+	for chat, ids := range seen {
+		assert.IsIncreasing(t, ids, "updates from chat %d were processed out of order", chat)
+	}
+	assert.Len(t, seen, chats)
+}
+
+func TestBot_ShardedWorkers_SlowChat(t *testing.T) {
+	const workers = 2
+
+	// the chats are assigned to different workers
+	slowChat, fastChat := int64(1), int64(2)
+	for shard(strconv.FormatInt(slowChat, 10), workers) == shard(strconv.FormatInt(fastChat, 10), workers) {
+		fastChat++
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	handled := make(chan int64, 1)
+
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Logger: logr.Discard(), WorkerPool: workers, ShardBy: ShardByChat}
+	b.Handle(UpdateTypeMessage, func(ctx *Context) error {
+		chat := ctx.MustGetMessage().Chat.ID
+		if chat == slowChat {
+			<-release
+			return nil
+		}
+		handled <- chat
+		return nil
+	})
+	b.init(context.Background())
+	b.startWorkers(&lifecycle{})
+	defer b.cancel()
+
+	// the second update from the slow chat waits for the first one
+	go func() {
+		for _, chat := range []int64{slowChat, slowChat, fastChat} {
+			select {
+			case b.chUpdate <- Update{Message: &Message{Chat: Chat{ID: chat}}}:
+			case <-release:
+				return
+			}
+		}
+	}()
+
+	select {
+	case chat := <-handled:
+		assert.Equal(t, fastChat, chat)
+	case <-time.After(time.Second):
+		t.Fatal("the update from another chat is blocked by the slow handler")
+	}
+}
+
+func TestBot_ShardedWorkers_Backpressure(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Logger: logr.Discard(), WorkerPool: 1, ChanSize: 1, ShardBy: ShardByChat}
+	b.Handle(UpdateTypeMessage, func(ctx *Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	b.init(context.Background())
+	b.startWorkers(&lifecycle{})
+	defer b.cancel()
+
+	send := func(id int) bool {
+		select {
+		case b.chUpdate <- Update{UpdateID: id, Message: &Message{Chat: Chat{ID: 1}}}:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	assert.True(t, send(1))
+	<-started
+	// waiting for the worker, held by the dispatcher and in b.chUpdate
+	for id := 2; id <= 4; id++ {
+		assert.True(t, send(id), "update %d", id)
+	}
+	assert.False(t, send(5), "the full worker must slow down the receiver")
+}
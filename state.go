@@ -0,0 +1,341 @@
+package botify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bigelle/botify/internal/jsonfile"
+)
+
+// ErrNoStateData is returned by [Context.GetStateData] if there's no value for the given key.
+var ErrNoStateData = errors.New("no state data for the given key")
+
+// StateKey identifies the conversation the state belongs to:
+// the user in the chat, and the forum topic if there's any.
+type StateKey struct {
+	ChatID   int64
+	UserID   int
+	ThreadID int
+}
+
+func (k StateKey) String() string {
+	return fmt.Sprintf("%d:%d:%d", k.ChatID, k.UserID, k.ThreadID)
+}
+
+// stateKey returns the key of the conversation the update belongs to,
+// or false if it has neither chat nor user
+func stateKey(upd *Update) (StateKey, bool) {
+	var key StateKey
+
+	chat := upd.EffectiveChat()
+	user := upd.EffectiveUser()
+	if chat == nil && user == nil {
+		return key, false
+	}
+
+	if chat != nil {
+		key.ChatID = chat.ID
+	}
+	if user != nil {
+		key.UserID = user.ID
+	}
+	if msg := upd.EffectiveMessage(); msg != nil && msg.IsTopicMessage != nil && *msg.IsTopicMessage && msg.MessageThreadId != nil {
+		key.ThreadID = *msg.MessageThreadId
+	}
+	return key, true
+}
+
+// StateRecord is the state of the conversation with the data collected so far.
+type StateRecord struct {
+	State string `json:"state"`
+	// Values are JSON-encoded, see [Context.SetStateData] and [Context.GetStateData]
+	Data map[string]json.RawMessage `json:"data,omitempty"`
+	// Zero value means the state never expires
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// IsExpired reports whether the state has expired by now.
+func (r *StateRecord) IsExpired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// StateStorage is used to store conversation states between updates.
+// Implementations must be safe for concurrent use
+// and must never return expired records.
+type StateStorage interface {
+	// GetState returns the record associated with the key,
+	// or nil without any error if there's none.
+	GetState(ctx context.Context, key StateKey) (*StateRecord, error)
+	// SetState associates the record with the key, replacing the existing one.
+	SetState(ctx context.Context, key StateKey, rec *StateRecord) error
+	// DeleteState removes the record associated with the key, if any.
+	DeleteState(ctx context.Context, key StateKey) error
+}
+
+// MemoryStateStorage is an in-memory implementation of [StateStorage].
+// Every state is lost when the program exits.
+// It is ready to use with its zero value.
+type MemoryStateStorage struct {
+	mu      sync.Mutex
+	records map[StateKey]StateRecord
+}
+
+// GetState satisfies the StateStorage interface
+func (s *MemoryStateStorage) GetState(_ context.Context, key StateKey) (*StateRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	if rec.IsExpired(time.Now()) {
+		delete(s.records, key)
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+// SetState satisfies the StateStorage interface
+func (s *MemoryStateStorage) SetState(_ context.Context, key StateKey, rec *StateRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		s.records = make(map[StateKey]StateRecord)
+	}
+	s.records[key] = *rec
+	return nil
+}
+
+// DeleteState satisfies the StateStorage interface
+func (s *MemoryStateStorage) DeleteState(_ context.Context, key StateKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// FileStateStorage is an implementation of [StateStorage],
+// which keeps every state in memory and saves them into the local JSON file on every change,
+// so they survive restarts.
+// The file is read once, on the first use.
+// It is not meant to be shared between several running programs.
+type FileStateStorage struct {
+	// Path to the file. It will be created if it doesn't exist.
+	Path string
+
+	mu      sync.Mutex
+	loaded  bool
+	records map[string]StateRecord
+}
+
+// GetState satisfies the StateStorage interface
+func (s *FileStateStorage) GetState(_ context.Context, key StateKey) (*StateRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	rec, ok := s.records[key.String()]
+	if !ok || rec.IsExpired(time.Now()) {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+// SetState satisfies the StateStorage interface
+func (s *FileStateStorage) SetState(_ context.Context, key StateKey, rec *StateRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.records[key.String()] = *rec
+	return s.flush()
+}
+
+// DeleteState satisfies the StateStorage interface
+func (s *FileStateStorage) DeleteState(_ context.Context, key StateKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.records[key.String()]; !ok {
+		return nil
+	}
+	delete(s.records, key.String())
+	return s.flush()
+}
+
+func (s *FileStateStorage) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.Path == "" {
+		return fmt.Errorf("state storage file path is empty")
+	}
+
+	s.records = make(map[string]StateRecord)
+	if err := jsonfile.Read(s.Path, &s.records); err != nil {
+		return fmt.Errorf("loading states: %w", err)
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *FileStateStorage) flush() error {
+	now := time.Now()
+	for key, rec := range s.records {
+		if rec.IsExpired(now) {
+			delete(s.records, key)
+		}
+	}
+
+	if err := jsonfile.Write(s.Path, s.records); err != nil {
+		return fmt.Errorf("saving states: %w", err)
+	}
+	return nil
+}
+
+// InState matches updates from the conversations which are in one of the given states.
+// Empty string matches the conversations with no state.
+func InState(states ...string) Filter {
+	return func(ctx *Context) bool {
+		state := ctx.State()
+		for _, s := range states {
+			if s == state {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// loadState reads the state of the conversation once, and caches it
+func (c *Context) loadState() *StateRecord {
+	if c.stateLoaded {
+		return c.state
+	}
+	c.stateLoaded = true
+
+	key, ok := stateKey(c.upd)
+	if !ok {
+		return nil
+	}
+
+	rec, err := c.bot.States.GetState(c.Context(), key)
+	if err != nil {
+		c.bot.Logger.Error(err, "loading conversation state", "key", key.String())
+		return nil
+	}
+	c.state = rec
+	return c.state
+}
+
+// saveState writes rec as the state of the conversation
+func (c *Context) saveState(rec *StateRecord) error {
+	key, ok := stateKey(c.upd)
+	if !ok {
+		return fmt.Errorf("the update belongs to no conversation")
+	}
+	if err := c.bot.States.SetState(c.Context(), key, rec); err != nil {
+		return fmt.Errorf("saving conversation state: %w", err)
+	}
+	c.state, c.stateLoaded = rec, true
+	return nil
+}
+
+// State returns the current state of the conversation the update belongs to,
+// or an empty string if there's none.
+// Storage errors are logged and treated as no state.
+func (c *Context) State() string {
+	rec := c.loadState()
+	if rec == nil {
+		return ""
+	}
+	return rec.State
+}
+
+// SetState moves the conversation into the given state, keeping the data collected so far.
+// The state expires after [Bot.StateTimeout], if it's set.
+func (c *Context) SetState(state string) error {
+	return c.SetStateWithTimeout(state, c.bot.StateTimeout)
+}
+
+// SetStateWithTimeout works just like [Context.SetState],
+// but the state expires after the given timeout instead of [Bot.StateTimeout].
+// Zero timeout means the state never expires.
+func (c *Context) SetStateWithTimeout(state string, timeout time.Duration) error {
+	rec := StateRecord{State: state}
+	if prev := c.loadState(); prev != nil {
+		rec.Data = prev.Data
+	}
+	if timeout > 0 {
+		rec.ExpiresAt = time.Now().Add(timeout)
+	}
+	return c.saveState(&rec)
+}
+
+// ClearState finishes the conversation, removing its state and data.
+func (c *Context) ClearState() error {
+	key, ok := stateKey(c.upd)
+	if !ok {
+		return nil
+	}
+	if err := c.bot.States.DeleteState(c.Context(), key); err != nil {
+		return fmt.Errorf("removing conversation state: %w", err)
+	}
+	c.state, c.stateLoaded = nil, true
+	return nil
+}
+
+// SetStateData stores the value encoded as JSON in the data of the current state.
+// The data is kept until the state is cleared or expired.
+func (c *Context) SetStateData(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding state data: %w", err)
+	}
+
+	var rec StateRecord
+	if prev := c.loadState(); prev != nil {
+		rec = *prev
+	}
+
+	data := make(map[string]json.RawMessage, len(rec.Data)+1)
+	for k, v := range rec.Data {
+		data[k] = v
+	}
+	data[key] = raw
+	rec.Data = data
+
+	return c.saveState(&rec)
+}
+
+// GetStateData decodes the value stored with [Context.SetStateData] into dest.
+// It returns [ErrNoStateData] if there's no value for the key.
+func (c *Context) GetStateData(key string, dest any) error {
+	rec := c.loadState()
+	if rec == nil {
+		return ErrNoStateData
+	}
+	raw, ok := rec.Data[key]
+	if !ok {
+		return ErrNoStateData
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return fmt.Errorf("decoding state data: %w", err)
+	}
+	return nil
+}
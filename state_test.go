@@ -0,0 +1,81 @@
+package botify
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStateStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "states.json")
+	key := StateKey{ChatID: -100, UserID: 1, ThreadID: 5}
+	expired := StateKey{ChatID: -100, UserID: 2}
+
+	s := &FileStateStorage{Path: path}
+	assert.NoError(t, s.SetState(context.Background(), key, &StateRecord{State: "awaiting_name"}))
+	assert.NoError(t, s.SetState(context.Background(), expired, &StateRecord{State: "old", ExpiresAt: time.Now().Add(-time.Second)}))
+
+	// reading from the same file as if the program was restarted
+	s = &FileStateStorage{Path: path}
+
+	rec, err := s.GetState(context.Background(), key)
+	if assert.NoError(t, err) && assert.NotNil(t, rec) {
+		assert.Equal(t, "awaiting_name", rec.State)
+	}
+
+	rec, err = s.GetState(context.Background(), expired)
+	assert.NoError(t, err)
+	assert.Nil(t, rec)
+
+	assert.NoError(t, s.DeleteState(context.Background(), key))
+	rec, err = s.GetState(context.Background(), key)
+	assert.NoError(t, err)
+	assert.Nil(t, rec)
+}
+
+func TestBot_HandleState(t *testing.T) {
+	var name string
+
+	b := &Bot{Token: "1:token", Sender: &testSender{}, Logger: logr.Discard()}
+	b.HandleCommand("/register", "Register", func(ctx *Context) error {
+		return ctx.SetState("awaiting_name")
+	})
+	b.HandleState("awaiting_name", func(ctx *Context) error {
+		if err := ctx.SetStateData("name", *ctx.MustGetMessage().Text); err != nil {
+			return err
+		}
+		return ctx.SetState("awaiting_confirmation")
+	})
+	b.HandleState("awaiting_confirmation", func(ctx *Context) error {
+		if err := ctx.GetStateData("name", &name); err != nil {
+			return err
+		}
+		return ctx.ClearState()
+	})
+	b.init(context.Background())
+
+	user := User{ID: 1}
+	messages := []*Message{
+		{Chat: Chat{ID: 1}, From: &user, Text: strPointer("/register"), Entities: &[]MessageEntity{{Type: "bot_command", Length: 9}}},
+		{Chat: Chat{ID: 1}, From: &user, Text: strPointer("Alice")},
+		{Chat: Chat{ID: 1}, From: &user, Text: strPointer("yes")},
+	}
+	states := []string{"awaiting_name", "awaiting_confirmation", ""}
+
+	for i, msg := range messages {
+		upd := Update{Message: msg}
+		ctx := Context{bot: b, upd: &upd, updType: upd.UpdateType(), ctx: b.ctx}
+
+		handler, ok := b.pickHandler(&ctx)
+		if !assert.True(t, ok) {
+			t.FailNow()
+		}
+		assert.NoError(t, handler(&ctx))
+		assert.Equal(t, states[i], ctx.State())
+	}
+	assert.Equal(t, "Alice", name)
+}
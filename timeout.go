@@ -0,0 +1,57 @@
+package botify
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrHandlerTimeout is logged when the handler doesn't finish its work in time,
+// see [Bot.HandlerTimeout] and [Timeout].
+var ErrHandlerTimeout = errors.New("handler timed out")
+
+// Timeout returns a middleware, which limits the time given to the handler.
+// The handler's [Context.Context] is cancelled once the timeout is exceeded,
+// so the handler is expected to pass it to every slow call, e.g. with [Context.SendRequestContext].
+// The handler itself is not interrupted.
+//
+// When the handler returns after the timeout, it's logged, and [Bot.OnHandlerTimeout] is called, if it's set.
+// Zero or negative timeout means no limit.
+// To limit every handler at once, use [Bot.HandlerTimeout].
+func Timeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		if d <= 0 {
+			return next
+		}
+
+		return func(ctx *Context) error {
+			parent := ctx.ctx
+			withTimeout, cancel := context.WithTimeout(parent, d)
+			ctx.ctx = withTimeout
+
+			err := next(ctx)
+
+			// the parent's own deadline is not the handler's fault
+			timedOut := withTimeout.Err() == context.DeadlineExceeded && parent.Err() == nil
+			cancel()
+			ctx.ctx = parent
+
+			if timedOut {
+				ctx.handlerTimedOut(d)
+			}
+			return err
+		}
+	}
+}
+
+// handlerTimedOut reports that the handler hasn't finished its work in time
+func (c *Context) handlerTimedOut(d time.Duration) {
+	if c.bot == nil {
+		return
+	}
+
+	c.bot.Logger.Error(ErrHandlerTimeout, "handler has exceeded its timeout", "type", c.UpdateType(), "ID", c.UpdateID(), "timeout", d)
+	if c.bot.OnHandlerTimeout != nil {
+		c.bot.OnHandlerTimeout(c)
+	}
+}
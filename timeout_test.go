@@ -0,0 +1,58 @@
+package botify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		work        time.Duration
+		wantTimeout bool
+	}{
+		{name: "in time", timeout: 50 * time.Millisecond, work: 0},
+		{name: "exceeded", timeout: 5 * time.Millisecond, work: 50 * time.Millisecond, wantTimeout: true},
+		{name: "no limit", timeout: 0, work: 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				timedOut   bool
+				hookCtxErr error
+			)
+			b := &Bot{Logger: logr.Discard(), OnHandlerTimeout: func(ctx *Context) {
+				timedOut = true
+				hookCtxErr = ctx.Context().Err()
+			}}
+
+			h := Timeout(tt.timeout)(func(ctx *Context) error {
+				select {
+				case <-time.After(tt.work):
+					return nil
+				case <-ctx.Context().Done():
+					return ctx.Context().Err()
+				}
+			})
+
+			upd := Update{Message: &Message{}}
+			ctx := &Context{bot: b, upd: &upd, ctx: context.Background()}
+			err := h(ctx)
+
+			assert.Equal(t, tt.wantTimeout, timedOut)
+			assert.NoError(t, hookCtxErr)
+			assert.NoError(t, ctx.Context().Err(), "the context must be restored")
+			if tt.wantTimeout {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -31,7 +31,7 @@ type User struct {
 	FirstName               string  `json:"first_name"`
 	IsBot                   bool    `json:"is_bot"`
 	LastName                *string `json:"last_name,omitempty"`
-	UserName                *string `json:"user_name,omitempty"`
+	UserName                *string `json:"username,omitempty"`
 	LanguageCode            *string `json:"language_code,omitempty"`
 	CanJoinGroups           *bool   `json:"can_join_groups,omitempty"`
 	CanReadAllGroupMessages *bool   `json:"can_read_all_group_messages,omitempty"`
@@ -46,7 +46,7 @@ type Chat struct {
 	ID        int64   `json:"id"`
 	Type      string  `json:"type"`
 	Title     *string `json:"title,omitempty"`
-	UserName  *string `json:"user_name,omitempty"`
+	UserName  *string `json:"username,omitempty"`
 	FirstName *string `json:"first_name,omitempty"`
 	LastName  *string `json:"last_name,omitempty"`
 	IsForum   *bool   `json:"is_forum,omitempty"`
@@ -232,6 +232,22 @@ type MessageId struct {
 	MessageId int `json:"message_id"`
 }
 
+// EditedMessage is the result of the methods editing messages, like [EditMessageText].
+// Message is nil if the edited message was sent via the bot in inline mode,
+// in which case Telegram returns true instead of the message
+type EditedMessage struct {
+	Message *Message
+}
+
+func (m *EditedMessage) UnmarshalJSON(data []byte) error {
+	if string(data) == "true" {
+		m.Message = nil
+		return nil
+	}
+	m.Message = new(Message)
+	return json.Unmarshal(data, m.Message)
+}
+
 type InaccessibleMessage struct {
 	Chat      Chat `json:"chat"`
 	MessageId int  `json:"message_id"`
@@ -805,7 +821,7 @@ type ReplyKeyboardRemove struct {
 func (f ReplyKeyboardRemove) replyKeyboardContract() {}
 
 type InlineKeyboardMarkup struct {
-	Keyboard [][]InlineKeyboardButton `json:"keyboard"`
+	Keyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
 }
 
 func (f InlineKeyboardMarkup) replyKeyboardContract() {}
@@ -947,7 +963,7 @@ type ChatMember struct {
 
 type ChatJoinRequest struct {
 	Chat       Chat            `json:"chat"`
-	User       User            `json:"user"`
+	User       User            `json:"from"`
 	UserChatId int64           `json:"user_chat_id"`
 	Date       int             `json:"date"`
 	Bio        *string         `json:"bio,omitempty"`
@@ -1255,11 +1271,11 @@ type MenuButton struct {
 }
 
 type ChatBoostSource struct {
-	Source            string  `json:"source"`
-	User              *User   `json:"user,omitempty"`
-	GiveawayMessageId *string `json:"giveaway_message_id,omitempty"`
-	PrizeStarCount    *int    `json:"prize_star_count,omitempty"`
-	IsUnclaimed       *bool   `json:"is_unclaimed,omitempty"`
+	Source            string `json:"source"`
+	User              *User  `json:"user,omitempty"`
+	GiveawayMessageId *int   `json:"giveaway_message_id,omitempty"`
+	PrizeStarCount    *int   `json:"prize_star_count,omitempty"`
+	IsUnclaimed       *bool  `json:"is_unclaimed,omitempty"`
 }
 
 type ChatBoostSourcePremium struct {
@@ -1274,7 +1290,7 @@ type ChatBoostSourceGiftCode struct {
 
 type ChatBoostSourceGiveaway struct {
 	Source            string `json:"source"`
-	GiveawayMessageId string `json:"giveaway_message_id"`
+	GiveawayMessageId int    `json:"giveaway_message_id"`
 	User              *User  `json:"user,omitempty"`
 	PrizeStarCount    *int   `json:"prize_star_count,omitempty"`
 	IsUnclaimed       *bool  `json:"is_unclaimed,omitempty"`
@@ -2169,7 +2185,7 @@ type PreCheckoutQuery struct {
 }
 
 type PaidMediaPurchased struct {
-	User             User   `json:"user"`
+	User             User   `json:"from"`
 	PaidMediaPayload string `json:"paid_media_payload"`
 }
 
@@ -2,6 +2,9 @@ package botify
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 )
 
 const (
@@ -57,34 +60,34 @@ var allUpdTypes = map[string]struct{}{
 }
 
 type Update struct {
-	UpdateID          int      `json:"update_id"`
-	Message           *Message `json:"message,omitempty"`
-	EditedMessage     *Message `json:"edited_message,omitempty"`
-	ChannelPost       *Message `json:"channel_post,omitempty"`
-	EditedChannelPost *Message `json:"edited_channel_post,omitempty"`
-	// BusinessConnection      *BusinessConnection          `json:"business_connection,omitempty"`
-	BusinessMessage       *Message `json:"business_message,omitempty"`
-	EditedBusinessMessage *Message `json:"edited_business_message,omitempty"`
-	// DeletedBusinessMessages *BusinessMessagesDeleted     `json:"deleted_business_messages,omitempty"`
-	// MessageReaction         *MessageReactionUpdated      `json:"message_reaction,omitempty"`
-	// MessageReactionCount    *MessageReactionCountUpdated `json:"message_reaction_count,omitempty"`
-	// InlineQuery             *InlineQuery                 `json:"inline_query,omitempty"`
-	// ChosenInlineResult      *ChosenInlineResult          `json:"chosen_inline_result,omitempty"`
-	// CallbackQuery           *CallbackQuery               `json:"callback_query,omitempty"`
-	// ShippingQuery           *ShippingQuery               `json:"shipping_query,omitempty"`
-	// PreCheckoutQuery        *PreCheckoutQuery            `json:"pre_checkout_query,omitempty"`
-	// PurchasedPaidMedia      *PaidMediaPurchased          `json:"purchased_paid_media,omitempty"`
-	// Poll                    *Poll                        `json:"poll,omitempty"`
-	// PollAnswer              *PollAnswer                  `json:"poll_answer,omitempty"`
-	// MyChatMember            *ChatMemberUpdated           `json:"my_chat_member,omitempty"`
-	// ChatMember              *ChatMemberUpdated           `json:"chat_member,omitempty"`
-	// ChatJoinRequest         *ChatJoinRequest             `json:"chat_join_request,omitempty"`
-	// ChatBoost               *ChatBoostUpdated            `json:"chat_boost,omitempty"`
-	// RemovedChatBoost        *ChatBoostRemoved            `json:"removed_chat_boost,omitempty"`
+	UpdateID                int                          `json:"update_id"`
+	Message                 *Message                     `json:"message,omitempty"`
+	EditedMessage           *Message                     `json:"edited_message,omitempty"`
+	ChannelPost             *Message                     `json:"channel_post,omitempty"`
+	EditedChannelPost       *Message                     `json:"edited_channel_post,omitempty"`
+	BusinessConnection      *BusinessConnection          `json:"business_connection,omitempty"`
+	BusinessMessage         *Message                     `json:"business_message,omitempty"`
+	EditedBusinessMessage   *Message                     `json:"edited_business_message,omitempty"`
+	DeletedBusinessMessages *BusinessMessagesDeleted     `json:"deleted_business_messages,omitempty"`
+	MessageReaction         *MessageReactionUpdated      `json:"message_reaction,omitempty"`
+	MessageReactionCount    *MessageReactionCountUpdated `json:"message_reaction_count,omitempty"`
+	InlineQuery             *InlineQuery                 `json:"inline_query,omitempty"`
+	ChosenInlineResult      *ChosenInlineResult          `json:"chosen_inline_result,omitempty"`
+	CallbackQuery           *CallbackQuery               `json:"callback_query,omitempty"`
+	ShippingQuery           *ShippingQuery               `json:"shipping_query,omitempty"`
+	PreCheckoutQuery        *PreCheckoutQuery            `json:"pre_checkout_query,omitempty"`
+	PurchasedPaidMedia      *PaidMediaPurchased          `json:"purchased_paid_media,omitempty"`
+	Poll                    *Poll                        `json:"poll,omitempty"`
+	PollAnswer              *PollAnswer                  `json:"poll_answer,omitempty"`
+	MyChatMember            *ChatMemberUpdated           `json:"my_chat_member,omitempty"`
+	ChatMember              *ChatMemberUpdated           `json:"chat_member,omitempty"`
+	ChatJoinRequest         *ChatJoinRequest             `json:"chat_join_request,omitempty"`
+	ChatBoost               *ChatBoostUpdated            `json:"chat_boost,omitempty"`
+	RemovedChatBoost        *ChatBoostRemoved            `json:"removed_chat_boost,omitempty"`
 }
 
 // UpdateType returns update type as defined in [Update]
-// 
+//
 // [Update]: https://core.telegram.org/bots/api#update
 func (u *Update) UpdateType() string {
 	checks := []struct {
@@ -95,8 +98,25 @@ func (u *Update) UpdateType() string {
 		{u.EditedMessage != nil, UpdateTypeEditedMessage},
 		{u.ChannelPost != nil, UpdateTypeChannelPost},
 		{u.EditedChannelPost != nil, UpdateTypeEditedChannelPost},
+		{u.BusinessConnection != nil, UpdateTypeBusinessConnection},
 		{u.BusinessMessage != nil, UpdateTypeBusinessMessage},
 		{u.EditedBusinessMessage != nil, UpdateTypeEditedBusinessMessage},
+		{u.DeletedBusinessMessages != nil, UpdateTypeDeletedBusinessMessages},
+		{u.MessageReaction != nil, UpdateTypeMessageReaction},
+		{u.MessageReactionCount != nil, UpdateTypeMessageReactionCount},
+		{u.InlineQuery != nil, UpdateTypeInlineQuery},
+		{u.ChosenInlineResult != nil, UpdateTypeChosenInlineResult},
+		{u.CallbackQuery != nil, UpdateTypeCallbackQuery},
+		{u.ShippingQuery != nil, UpdateTypeShippingQuery},
+		{u.PreCheckoutQuery != nil, UpdateTypePreCheckoutQuery},
+		{u.PurchasedPaidMedia != nil, UpdateTypePurchasedPaidMedia},
+		{u.Poll != nil, UpdateTypePoll},
+		{u.PollAnswer != nil, UpdateTypePollAnswer},
+		{u.MyChatMember != nil, UpdateTypeMyChatMember},
+		{u.ChatMember != nil, UpdateTypeChatMember},
+		{u.ChatJoinRequest != nil, UpdateTypeChatJoinRequest},
+		{u.ChatBoost != nil, UpdateTypeChatBoost},
+		{u.RemovedChatBoost != nil, UpdateTypeRemovedChatBoost},
 	}
 
 	for _, check := range checks {
@@ -111,6 +131,21 @@ func (u *Update) UpdateType() string {
 // HandlerFunc is a function used to handle incoming updates.
 type HandlerFunc func(ctx *Context) error
 
+// Middleware wraps next [HandlerFunc] with some additional logic,
+// e.g. logging, authorization or panic recovery.
+// It's up to middleware whether next will be called or not.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// WrapHandler applies middleware to the handler.
+// The first middleware is the outermost one,
+// so WrapHandler(h, a, b) is equivalent to a(b(h)).
+func WrapHandler(handler HandlerFunc, middleware ...Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
 func ChainHandlers(handlers ...HandlerFunc) HandlerFunc {
 	return func(ctx *Context) error {
 		for _, handler := range handlers {
@@ -128,8 +163,19 @@ func ChainHandlers(handlers ...HandlerFunc) HandlerFunc {
 type Context struct {
 	bot *Bot
 
-	updType        string
-	upd            *Update
+	updType string
+	upd     *Update
+
+	// extracted from callback data, see [Bot.HandleCallback]
+	params   map[string]string
+	answered bool
+
+	// conversation state, loaded on demand
+	state       *StateRecord
+	stateLoaded bool
+
+	// non-nil if the first request can be sent in the response to the webhook request
+	response *webhookResponse
 
 	ctx context.Context
 }
@@ -155,13 +201,42 @@ func (c *Context) SendJSON(endpoint string, obj any) (*APIResponse, error) {
 // to send a request with payload, content-type and to the API endpoint, defined in obj,
 // and can be cancelled with ctx
 func (c *Context) SendRequestContext(ctx context.Context, obj APIMethod) (*APIResponse, error) {
-	return c.bot.Sender.SendWithContext(ctx, obj)
+	if obj != nil && c.captureResponse(obj.APIEndpoint(), obj, obj.WritePayload) {
+		c.checkAnswered(obj)
+		return respondedResult(), nil
+	}
+
+	resp, err := c.bot.Sender.SendWithContext(ctx, obj)
+	if err == nil {
+		c.checkAnswered(obj)
+	}
+	return resp, err
+}
+
+// checkAnswered remembers if obj answers the callback query of this update,
+// so it won't be answered automatically
+func (c *Context) checkAnswered(obj APIMethod) {
+	if c.upd.CallbackQuery == nil {
+		return
+	}
+	switch m := obj.(type) {
+	case AnswerCallbackQuery:
+		c.answered = c.answered || m.CallbackQueryID == c.upd.CallbackQuery.Id
+	case *AnswerCallbackQuery:
+		c.answered = c.answered || m.CallbackQueryID == c.upd.CallbackQuery.Id
+	}
 }
 
 // SendJSONContext is using bot's [RequestSender]
 // to send obj as JSON to the endpoint,
 // and can be cancelled with ctx
 func (c *Context) SendJSONContext(ctx context.Context, endpoint string, obj any) (*APIResponse, error) {
+	if c.captureResponse(endpoint, obj, func(w io.Writer) (string, error) {
+		return "application/json", json.NewEncoder(w).Encode(obj)
+	}) {
+		return respondedResult(), nil
+	}
+
 	return c.bot.Sender.SendJSONWithContext(ctx, endpoint, obj)
 }
 
@@ -182,9 +257,23 @@ func (c *Context) UpdateID() int {
 // Context returns [context.Context],
 // which in most cases is [context.WithCancel],
 // controlled by the currently active bot instance.
+// It carries the values and the deadline of the context passed to [Bot.ServeContext].
 // Useful as a parent context for timeouts and deadlines.
 func (c *Context) Context() context.Context {
-	return c.Context()
+	return c.ctx
+}
+
+// Param returns the value of the named parameter
+// extracted from the callback data by the pattern used in [Bot.HandleCallback].
+// It returns an empty string if there is no such parameter.
+func (c *Context) Param(name string) string {
+	return c.params[name]
+}
+
+// Params returns every parameter extracted from the callback data
+// by the pattern used in [Bot.HandleCallback].
+func (c *Context) Params() map[string]string {
+	return c.params
 }
 
 // SetValue sets the value for the inner [context.Context],
@@ -222,3 +311,340 @@ func (c *Context) MustGetMessage() *Message {
 func (c *Context) GetMessage() *Message {
 	return c.upd.Message
 }
+
+// MustGetEditedMessage returns a pointer to the update's [Message].
+// It is safe to call for MustGetEditedMessage if the handler is subscribed to [UpdateTypeEditedMessage],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetEditedMessage() *Message {
+	return mustGet(c, UpdateTypeEditedMessage, c.upd.EditedMessage)
+}
+
+// GetEditedMessage returns a pointer to the update's [Message].
+// If you're not sure about the update type, it is safe to use GetEditedMessage and check for a nil value.
+// Unlike [MustGetEditedMessage], it will never panic.
+func (c *Context) GetEditedMessage() *Message {
+	return c.upd.EditedMessage
+}
+
+// MustGetChannelPost returns a pointer to the update's [Message].
+// It is safe to call for MustGetChannelPost if the handler is subscribed to [UpdateTypeChannelPost],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetChannelPost() *Message {
+	return mustGet(c, UpdateTypeChannelPost, c.upd.ChannelPost)
+}
+
+// GetChannelPost returns a pointer to the update's [Message].
+// If you're not sure about the update type, it is safe to use GetChannelPost and check for a nil value.
+// Unlike [MustGetChannelPost], it will never panic.
+func (c *Context) GetChannelPost() *Message {
+	return c.upd.ChannelPost
+}
+
+// MustGetEditedChannelPost returns a pointer to the update's [Message].
+// It is safe to call for MustGetEditedChannelPost if the handler is subscribed to [UpdateTypeEditedChannelPost],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetEditedChannelPost() *Message {
+	return mustGet(c, UpdateTypeEditedChannelPost, c.upd.EditedChannelPost)
+}
+
+// GetEditedChannelPost returns a pointer to the update's [Message].
+// If you're not sure about the update type, it is safe to use GetEditedChannelPost and check for a nil value.
+// Unlike [MustGetEditedChannelPost], it will never panic.
+func (c *Context) GetEditedChannelPost() *Message {
+	return c.upd.EditedChannelPost
+}
+
+// MustGetBusinessConnection returns a pointer to the update's [BusinessConnection].
+// It is safe to call for MustGetBusinessConnection if the handler is subscribed to [UpdateTypeBusinessConnection],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetBusinessConnection() *BusinessConnection {
+	return mustGet(c, UpdateTypeBusinessConnection, c.upd.BusinessConnection)
+}
+
+// GetBusinessConnection returns a pointer to the update's [BusinessConnection].
+// If you're not sure about the update type, it is safe to use GetBusinessConnection and check for a nil value.
+// Unlike [MustGetBusinessConnection], it will never panic.
+func (c *Context) GetBusinessConnection() *BusinessConnection {
+	return c.upd.BusinessConnection
+}
+
+// MustGetBusinessMessage returns a pointer to the update's [Message].
+// It is safe to call for MustGetBusinessMessage if the handler is subscribed to [UpdateTypeBusinessMessage],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetBusinessMessage() *Message {
+	return mustGet(c, UpdateTypeBusinessMessage, c.upd.BusinessMessage)
+}
+
+// GetBusinessMessage returns a pointer to the update's [Message].
+// If you're not sure about the update type, it is safe to use GetBusinessMessage and check for a nil value.
+// Unlike [MustGetBusinessMessage], it will never panic.
+func (c *Context) GetBusinessMessage() *Message {
+	return c.upd.BusinessMessage
+}
+
+// MustGetEditedBusinessMessage returns a pointer to the update's [Message].
+// It is safe to call for MustGetEditedBusinessMessage if the handler is subscribed to [UpdateTypeEditedBusinessMessage],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetEditedBusinessMessage() *Message {
+	return mustGet(c, UpdateTypeEditedBusinessMessage, c.upd.EditedBusinessMessage)
+}
+
+// GetEditedBusinessMessage returns a pointer to the update's [Message].
+// If you're not sure about the update type, it is safe to use GetEditedBusinessMessage and check for a nil value.
+// Unlike [MustGetEditedBusinessMessage], it will never panic.
+func (c *Context) GetEditedBusinessMessage() *Message {
+	return c.upd.EditedBusinessMessage
+}
+
+// MustGetDeletedBusinessMessages returns a pointer to the update's [BusinessMessagesDeleted].
+// It is safe to call for MustGetDeletedBusinessMessages if the handler is subscribed to [UpdateTypeDeletedBusinessMessages],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetDeletedBusinessMessages() *BusinessMessagesDeleted {
+	return mustGet(c, UpdateTypeDeletedBusinessMessages, c.upd.DeletedBusinessMessages)
+}
+
+// GetDeletedBusinessMessages returns a pointer to the update's [BusinessMessagesDeleted].
+// If you're not sure about the update type, it is safe to use GetDeletedBusinessMessages and check for a nil value.
+// Unlike [MustGetDeletedBusinessMessages], it will never panic.
+func (c *Context) GetDeletedBusinessMessages() *BusinessMessagesDeleted {
+	return c.upd.DeletedBusinessMessages
+}
+
+// MustGetMessageReaction returns a pointer to the update's [MessageReactionUpdated].
+// It is safe to call for MustGetMessageReaction if the handler is subscribed to [UpdateTypeMessageReaction],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetMessageReaction() *MessageReactionUpdated {
+	return mustGet(c, UpdateTypeMessageReaction, c.upd.MessageReaction)
+}
+
+// GetMessageReaction returns a pointer to the update's [MessageReactionUpdated].
+// If you're not sure about the update type, it is safe to use GetMessageReaction and check for a nil value.
+// Unlike [MustGetMessageReaction], it will never panic.
+func (c *Context) GetMessageReaction() *MessageReactionUpdated {
+	return c.upd.MessageReaction
+}
+
+// MustGetMessageReactionCount returns a pointer to the update's [MessageReactionCountUpdated].
+// It is safe to call for MustGetMessageReactionCount if the handler is subscribed to [UpdateTypeMessageReactionCount],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetMessageReactionCount() *MessageReactionCountUpdated {
+	return mustGet(c, UpdateTypeMessageReactionCount, c.upd.MessageReactionCount)
+}
+
+// GetMessageReactionCount returns a pointer to the update's [MessageReactionCountUpdated].
+// If you're not sure about the update type, it is safe to use GetMessageReactionCount and check for a nil value.
+// Unlike [MustGetMessageReactionCount], it will never panic.
+func (c *Context) GetMessageReactionCount() *MessageReactionCountUpdated {
+	return c.upd.MessageReactionCount
+}
+
+// MustGetInlineQuery returns a pointer to the update's [InlineQuery].
+// It is safe to call for MustGetInlineQuery if the handler is subscribed to [UpdateTypeInlineQuery],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetInlineQuery() *InlineQuery {
+	return mustGet(c, UpdateTypeInlineQuery, c.upd.InlineQuery)
+}
+
+// GetInlineQuery returns a pointer to the update's [InlineQuery].
+// If you're not sure about the update type, it is safe to use GetInlineQuery and check for a nil value.
+// Unlike [MustGetInlineQuery], it will never panic.
+func (c *Context) GetInlineQuery() *InlineQuery {
+	return c.upd.InlineQuery
+}
+
+// MustGetChosenInlineResult returns a pointer to the update's [ChosenInlineResult].
+// It is safe to call for MustGetChosenInlineResult if the handler is subscribed to [UpdateTypeChosenInlineResult],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetChosenInlineResult() *ChosenInlineResult {
+	return mustGet(c, UpdateTypeChosenInlineResult, c.upd.ChosenInlineResult)
+}
+
+// GetChosenInlineResult returns a pointer to the update's [ChosenInlineResult].
+// If you're not sure about the update type, it is safe to use GetChosenInlineResult and check for a nil value.
+// Unlike [MustGetChosenInlineResult], it will never panic.
+func (c *Context) GetChosenInlineResult() *ChosenInlineResult {
+	return c.upd.ChosenInlineResult
+}
+
+// MustGetCallbackQuery returns a pointer to the update's [CallbackQuery].
+// It is safe to call for MustGetCallbackQuery if the handler is subscribed to [UpdateTypeCallbackQuery],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetCallbackQuery() *CallbackQuery {
+	return mustGet(c, UpdateTypeCallbackQuery, c.upd.CallbackQuery)
+}
+
+// GetCallbackQuery returns a pointer to the update's [CallbackQuery].
+// If you're not sure about the update type, it is safe to use GetCallbackQuery and check for a nil value.
+// Unlike [MustGetCallbackQuery], it will never panic.
+func (c *Context) GetCallbackQuery() *CallbackQuery {
+	return c.upd.CallbackQuery
+}
+
+// MustGetShippingQuery returns a pointer to the update's [ShippingQuery].
+// It is safe to call for MustGetShippingQuery if the handler is subscribed to [UpdateTypeShippingQuery],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetShippingQuery() *ShippingQuery {
+	return mustGet(c, UpdateTypeShippingQuery, c.upd.ShippingQuery)
+}
+
+// GetShippingQuery returns a pointer to the update's [ShippingQuery].
+// If you're not sure about the update type, it is safe to use GetShippingQuery and check for a nil value.
+// Unlike [MustGetShippingQuery], it will never panic.
+func (c *Context) GetShippingQuery() *ShippingQuery {
+	return c.upd.ShippingQuery
+}
+
+// MustGetPreCheckoutQuery returns a pointer to the update's [PreCheckoutQuery].
+// It is safe to call for MustGetPreCheckoutQuery if the handler is subscribed to [UpdateTypePreCheckoutQuery],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetPreCheckoutQuery() *PreCheckoutQuery {
+	return mustGet(c, UpdateTypePreCheckoutQuery, c.upd.PreCheckoutQuery)
+}
+
+// GetPreCheckoutQuery returns a pointer to the update's [PreCheckoutQuery].
+// If you're not sure about the update type, it is safe to use GetPreCheckoutQuery and check for a nil value.
+// Unlike [MustGetPreCheckoutQuery], it will never panic.
+func (c *Context) GetPreCheckoutQuery() *PreCheckoutQuery {
+	return c.upd.PreCheckoutQuery
+}
+
+// MustGetPurchasedPaidMedia returns a pointer to the update's [PaidMediaPurchased].
+// It is safe to call for MustGetPurchasedPaidMedia if the handler is subscribed to [UpdateTypePurchasedPaidMedia],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetPurchasedPaidMedia() *PaidMediaPurchased {
+	return mustGet(c, UpdateTypePurchasedPaidMedia, c.upd.PurchasedPaidMedia)
+}
+
+// GetPurchasedPaidMedia returns a pointer to the update's [PaidMediaPurchased].
+// If you're not sure about the update type, it is safe to use GetPurchasedPaidMedia and check for a nil value.
+// Unlike [MustGetPurchasedPaidMedia], it will never panic.
+func (c *Context) GetPurchasedPaidMedia() *PaidMediaPurchased {
+	return c.upd.PurchasedPaidMedia
+}
+
+// MustGetPoll returns a pointer to the update's [Poll].
+// It is safe to call for MustGetPoll if the handler is subscribed to [UpdateTypePoll],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetPoll() *Poll {
+	return mustGet(c, UpdateTypePoll, c.upd.Poll)
+}
+
+// GetPoll returns a pointer to the update's [Poll].
+// If you're not sure about the update type, it is safe to use GetPoll and check for a nil value.
+// Unlike [MustGetPoll], it will never panic.
+func (c *Context) GetPoll() *Poll {
+	return c.upd.Poll
+}
+
+// MustGetPollAnswer returns a pointer to the update's [PollAnswer].
+// It is safe to call for MustGetPollAnswer if the handler is subscribed to [UpdateTypePollAnswer],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetPollAnswer() *PollAnswer {
+	return mustGet(c, UpdateTypePollAnswer, c.upd.PollAnswer)
+}
+
+// GetPollAnswer returns a pointer to the update's [PollAnswer].
+// If you're not sure about the update type, it is safe to use GetPollAnswer and check for a nil value.
+// Unlike [MustGetPollAnswer], it will never panic.
+func (c *Context) GetPollAnswer() *PollAnswer {
+	return c.upd.PollAnswer
+}
+
+// MustGetMyChatMember returns a pointer to the update's [ChatMemberUpdated].
+// It is safe to call for MustGetMyChatMember if the handler is subscribed to [UpdateTypeMyChatMember],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetMyChatMember() *ChatMemberUpdated {
+	return mustGet(c, UpdateTypeMyChatMember, c.upd.MyChatMember)
+}
+
+// GetMyChatMember returns a pointer to the update's [ChatMemberUpdated].
+// If you're not sure about the update type, it is safe to use GetMyChatMember and check for a nil value.
+// Unlike [MustGetMyChatMember], it will never panic.
+func (c *Context) GetMyChatMember() *ChatMemberUpdated {
+	return c.upd.MyChatMember
+}
+
+// MustGetChatMember returns a pointer to the update's [ChatMemberUpdated].
+// It is safe to call for MustGetChatMember if the handler is subscribed to [UpdateTypeChatMember],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetChatMember() *ChatMemberUpdated {
+	return mustGet(c, UpdateTypeChatMember, c.upd.ChatMember)
+}
+
+// GetChatMember returns a pointer to the update's [ChatMemberUpdated].
+// If you're not sure about the update type, it is safe to use GetChatMember and check for a nil value.
+// Unlike [MustGetChatMember], it will never panic.
+func (c *Context) GetChatMember() *ChatMemberUpdated {
+	return c.upd.ChatMember
+}
+
+// MustGetChatJoinRequest returns a pointer to the update's [ChatJoinRequest].
+// It is safe to call for MustGetChatJoinRequest if the handler is subscribed to [UpdateTypeChatJoinRequest],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetChatJoinRequest() *ChatJoinRequest {
+	return mustGet(c, UpdateTypeChatJoinRequest, c.upd.ChatJoinRequest)
+}
+
+// GetChatJoinRequest returns a pointer to the update's [ChatJoinRequest].
+// If you're not sure about the update type, it is safe to use GetChatJoinRequest and check for a nil value.
+// Unlike [MustGetChatJoinRequest], it will never panic.
+func (c *Context) GetChatJoinRequest() *ChatJoinRequest {
+	return c.upd.ChatJoinRequest
+}
+
+// MustGetChatBoost returns a pointer to the update's [ChatBoostUpdated].
+// It is safe to call for MustGetChatBoost if the handler is subscribed to [UpdateTypeChatBoost],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetChatBoost() *ChatBoostUpdated {
+	return mustGet(c, UpdateTypeChatBoost, c.upd.ChatBoost)
+}
+
+// GetChatBoost returns a pointer to the update's [ChatBoostUpdated].
+// If you're not sure about the update type, it is safe to use GetChatBoost and check for a nil value.
+// Unlike [MustGetChatBoost], it will never panic.
+func (c *Context) GetChatBoost() *ChatBoostUpdated {
+	return c.upd.ChatBoost
+}
+
+// MustGetRemovedChatBoost returns a pointer to the update's [ChatBoostRemoved].
+// It is safe to call for MustGetRemovedChatBoost if the handler is subscribed to [UpdateTypeRemovedChatBoost],
+// the return value is always non-nil.
+// Otherwise, it will panic.
+func (c *Context) MustGetRemovedChatBoost() *ChatBoostRemoved {
+	return mustGet(c, UpdateTypeRemovedChatBoost, c.upd.RemovedChatBoost)
+}
+
+// GetRemovedChatBoost returns a pointer to the update's [ChatBoostRemoved].
+// If you're not sure about the update type, it is safe to use GetRemovedChatBoost and check for a nil value.
+// Unlike [MustGetRemovedChatBoost], it will never panic.
+func (c *Context) GetRemovedChatBoost() *ChatBoostRemoved {
+	return c.upd.RemovedChatBoost
+}
+
+func mustGet[T any](c *Context, t string, v *T) *T {
+	if c.updType != t || v == nil {
+		panic(fmt.Sprintf("calling MustGet for %s when the update is %s", t, c.updType))
+	}
+	return v
+}
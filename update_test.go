@@ -0,0 +1,262 @@
+package botify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate_UpdateType(t *testing.T) {
+	const (
+		user    = `{"id":1,"is_bot":false,"first_name":"A"}`
+		group   = `{"id":-100,"type":"supergroup","title":"G"}`
+		private = `{"id":1,"type":"private","first_name":"A"}`
+		channel = `{"id":-200,"type":"channel","title":"C"}`
+		message = `{"message_id":1,"date":1700000000,"chat":` + private + `,"from":` + user + `,"text":"hi"}`
+		member  = `{"status":"member","user":` + user + `}`
+		left    = `{"status":"left","user":` + user + `}`
+	)
+
+	testcases := []struct {
+		Name   string
+		Input  string
+		Output string
+		// the ID of the effective user, if there's any
+		UserID int
+	}{
+		{
+			Name:   "message",
+			Input:  `{"update_id":1,"message":` + message + `}`,
+			Output: UpdateTypeMessage,
+			UserID: 1,
+		},
+		{
+			Name:   "edited message",
+			Input:  `{"update_id":2,"edited_message":{"message_id":1,"date":1700000000,"edit_date":1700000060,"chat":` + private + `,"from":` + user + `,"text":"hi!"}}`,
+			Output: UpdateTypeEditedMessage,
+			UserID: 1,
+		},
+		{
+			Name:   "channel post",
+			Input:  `{"update_id":3,"channel_post":{"message_id":1,"date":1700000000,"chat":` + channel + `,"sender_chat":` + channel + `,"text":"news"}}`,
+			Output: UpdateTypeChannelPost,
+		},
+		{
+			Name:   "edited channel post",
+			Input:  `{"update_id":4,"edited_channel_post":{"message_id":1,"date":1700000000,"edit_date":1700000060,"chat":` + channel + `,"text":"news!"}}`,
+			Output: UpdateTypeEditedChannelPost,
+		},
+		{
+			Name:   "business connection",
+			Input:  `{"update_id":5,"business_connection":{"id":"bc","user":` + user + `,"user_chat_id":1,"date":1700000000,"rights":{"can_reply":true},"is_enabled":true}}`,
+			Output: UpdateTypeBusinessConnection,
+			UserID: 1,
+		},
+		{
+			Name:   "business message",
+			Input:  `{"update_id":6,"business_message":{"message_id":1,"date":1700000000,"business_connection_id":"bc","chat":` + private + `,"from":` + user + `,"text":"hi"}}`,
+			Output: UpdateTypeBusinessMessage,
+			UserID: 1,
+		},
+		{
+			Name:   "edited business message",
+			Input:  `{"update_id":7,"edited_business_message":{"message_id":1,"date":1700000000,"business_connection_id":"bc","chat":` + private + `,"from":` + user + `,"text":"hi!"}}`,
+			Output: UpdateTypeEditedBusinessMessage,
+			UserID: 1,
+		},
+		{
+			Name:   "deleted business messages",
+			Input:  `{"update_id":8,"deleted_business_messages":{"business_connection_id":"bc","chat":` + private + `,"message_ids":[1,2]}}`,
+			Output: UpdateTypeDeletedBusinessMessages,
+		},
+		{
+			Name:   "message reaction",
+			Input:  `{"update_id":9,"message_reaction":{"chat":` + group + `,"message_id":1,"user":` + user + `,"date":1700000000,"old_reaction":[],"new_reaction":[{"type":"emoji","emoji":"👍"}]}}`,
+			Output: UpdateTypeMessageReaction,
+			UserID: 1,
+		},
+		{
+			Name:   "message reaction count",
+			Input:  `{"update_id":10,"message_reaction_count":{"chat":` + channel + `,"message_id":1,"date":1700000000,"reactions":[{"type":{"type":"emoji","emoji":"👍"},"total_count":3}]}}`,
+			Output: UpdateTypeMessageReactionCount,
+		},
+		{
+			Name:   "inline query",
+			Input:  `{"update_id":11,"inline_query":{"id":"q","from":` + user + `,"query":"cats","offset":"","chat_type":"private"}}`,
+			Output: UpdateTypeInlineQuery,
+			UserID: 1,
+		},
+		{
+			Name:   "chosen inline result",
+			Input:  `{"update_id":12,"chosen_inline_result":{"result_id":"r","from":` + user + `,"inline_message_id":"im","query":"cats"}}`,
+			Output: UpdateTypeChosenInlineResult,
+			UserID: 1,
+		},
+		{
+			Name:   "callback query",
+			Input:  `{"update_id":13,"callback_query":{"id":"q","from":` + user + `,"message":` + message + `,"chat_instance":"c","data":"x"}}`,
+			Output: UpdateTypeCallbackQuery,
+			UserID: 1,
+		},
+		{
+			Name:   "shipping query",
+			Input:  `{"update_id":14,"shipping_query":{"id":"s","from":` + user + `,"invoice_payload":"p","shipping_address":{"country_code":"NL","state":"","city":"Amsterdam","street_line1":"Dam 1","street_line2":"","post_code":"1012"}}}`,
+			Output: UpdateTypeShippingQuery,
+			UserID: 1,
+		},
+		{
+			Name:   "pre-checkout query",
+			Input:  `{"update_id":15,"pre_checkout_query":{"id":"p","from":` + user + `,"currency":"XTR","total_amount":10,"invoice_payload":"p"}}`,
+			Output: UpdateTypePreCheckoutQuery,
+			UserID: 1,
+		},
+		{
+			Name:   "purchased paid media",
+			Input:  `{"update_id":16,"purchased_paid_media":{"from":` + user + `,"paid_media_payload":"p"}}`,
+			Output: UpdateTypePurchasedPaidMedia,
+			UserID: 1,
+		},
+		{
+			Name:   "poll",
+			Input:  `{"update_id":17,"poll":{"id":"p","question":"?","options":[{"text":"yes","voter_count":1},{"text":"no","voter_count":0}],"total_voter_count":1,"is_closed":false,"is_anonymous":true,"type":"regular","allows_multiple_answers":false}}`,
+			Output: UpdateTypePoll,
+		},
+		{
+			Name:   "poll answer",
+			Input:  `{"update_id":18,"poll_answer":{"poll_id":"p","user":` + user + `,"option_ids":[0]}}`,
+			Output: UpdateTypePollAnswer,
+			UserID: 1,
+		},
+		{
+			Name:   "my chat member",
+			Input:  `{"update_id":19,"my_chat_member":{"chat":` + group + `,"from":` + user + `,"date":1700000000,"old_chat_member":` + left + `,"new_chat_member":` + member + `}}`,
+			Output: UpdateTypeMyChatMember,
+			UserID: 1,
+		},
+		{
+			Name:   "chat member",
+			Input:  `{"update_id":20,"chat_member":{"chat":` + group + `,"from":` + user + `,"date":1700000000,"old_chat_member":` + left + `,"new_chat_member":` + member + `}}`,
+			Output: UpdateTypeChatMember,
+			UserID: 1,
+		},
+		{
+			Name:   "chat join request",
+			Input:  `{"update_id":21,"chat_join_request":{"chat":` + group + `,"from":` + user + `,"user_chat_id":1,"date":1700000000,"bio":"hi"}}`,
+			Output: UpdateTypeChatJoinRequest,
+			UserID: 1,
+		},
+		{
+			Name:   "chat boost",
+			Input:  `{"update_id":22,"chat_boost":{"chat":` + channel + `,"boost":{"boost_id":"b","add_date":1700000000,"expiration_date":1702592000,"source":{"source":"giveaway","giveaway_message_id":42,"user":` + user + `}}}}`,
+			Output: UpdateTypeChatBoost,
+			UserID: 1,
+		},
+		{
+			Name:   "removed chat boost",
+			Input:  `{"update_id":23,"removed_chat_boost":{"chat":` + channel + `,"boost_id":"b","remove_date":1700000000,"source":{"source":"giveaway","giveaway_message_id":42,"is_unclaimed":true}}}`,
+			Output: UpdateTypeRemovedChatBoost,
+		},
+		{
+			Name:   "unknown",
+			Input:  `{"update_id":24,"something_new":{}}`,
+			Output: "",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var upd Update
+			if !assert.NoError(t, json.Unmarshal([]byte(tc.Input), &upd)) {
+				t.FailNow()
+			}
+			assert.Equal(t, tc.Output, upd.UpdateType())
+			if tc.UserID != 0 {
+				if user := upd.EffectiveUser(); assert.NotNil(t, user) {
+					assert.Equal(t, tc.UserID, user.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestContext_MustGet(t *testing.T) {
+	upd := Update{CallbackQuery: &CallbackQuery{Id: "q"}}
+	ctx := Context{upd: &upd, updType: upd.UpdateType()}
+
+	assert.Equal(t, "q", ctx.MustGetCallbackQuery().Id)
+	assert.Nil(t, ctx.GetInlineQuery())
+	assert.Panics(t, func() { ctx.MustGetInlineQuery() })
+}
+
+func TestUpdate_Effective(t *testing.T) {
+	user := User{ID: 1}
+	anon := User{ID: 2}
+	group := Chat{ID: -100, Type: ChatTypeSupergroup}
+
+	testcases := []struct {
+		Name       string
+		Input      Update
+		UserID     int
+		ChatID     int64
+		SenderID   int64
+		HasMessage bool
+	}{
+		{
+			Name:       "message",
+			Input:      Update{Message: &Message{From: &user, Chat: group}},
+			UserID:     1,
+			ChatID:     -100,
+			SenderID:   1,
+			HasMessage: true,
+		},
+		{
+			Name:       "anonymous admin",
+			Input:      Update{Message: &Message{From: &anon, SenderChat: &group, Chat: group}},
+			UserID:     2,
+			ChatID:     -100,
+			SenderID:   -100,
+			HasMessage: true,
+		},
+		{
+			Name:       "callback query",
+			Input:      Update{CallbackQuery: &CallbackQuery{From: user, Message: &MaybeInaccessibleMessage{From: &anon, Chat: group}}},
+			UserID:     1,
+			ChatID:     -100,
+			SenderID:   1,
+			HasMessage: true,
+		},
+		{
+			Name:     "chat join request",
+			Input:    Update{ChatJoinRequest: &ChatJoinRequest{User: user, Chat: group}},
+			UserID:   1,
+			ChatID:   -100,
+			SenderID: 1,
+		},
+		{
+			Name:     "inline query",
+			Input:    Update{InlineQuery: &InlineQuery{From: user}},
+			UserID:   1,
+			SenderID: 1,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if u := tc.Input.EffectiveUser(); assert.NotNil(t, u) {
+				assert.Equal(t, tc.UserID, u.ID)
+			}
+			if tc.ChatID != 0 {
+				if c := tc.Input.EffectiveChat(); assert.NotNil(t, c) {
+					assert.Equal(t, tc.ChatID, c.ID)
+				}
+			} else {
+				assert.Nil(t, tc.Input.EffectiveChat())
+			}
+			if s := tc.Input.EffectiveSender(); assert.NotNil(t, s) {
+				assert.Equal(t, tc.SenderID, s.ID())
+			}
+			assert.Equal(t, tc.HasMessage, tc.Input.EffectiveMessage() != nil)
+		})
+	}
+}
@@ -1,5 +1,11 @@
 package botify
 
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
 func notEmptyString(str string) func() bool {
 	return func() bool {
 		return len(str) != 0
@@ -17,3 +23,36 @@ func notEmptySlice[T any](sl []T) func() bool {
 		return len(sl) != 0 && sl != nil
 	}
 }
+
+func notEmptySlicePtr[T any](sl *[]T) func() bool {
+	return func() bool {
+		return sl != nil && len(*sl) != 0
+	}
+}
+
+// sleepContext pauses the current goroutine for d, or until ctx is done.
+// It returns false if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoff returns the exponentially growing delay before the next attempt,
+// with a random jitter, so the clients don't retry all at once
+func backoff(attempt int, lower, upper time.Duration) time.Duration {
+	d := lower
+	for i := 0; i < attempt && d < upper; i++ {
+		d *= 2
+	}
+	d = min(d, upper)
+
+	half := d / 2
+	return half + rand.N(half+1)
+}